@@ -9,5 +9,14 @@ func NewAgentCmd() *cobra.Command {
 	}
 	agentCmd.AddCommand(NewCSCmd())
 	agentCmd.AddCommand(NewGitCredentialsCmd())
+	agentCmd.AddCommand(NewSetupGPGCmd())
+	agentCmd.AddCommand(NewKubeConfigCmd())
+	agentCmd.AddCommand(NewDotfilesCmd())
+	agentCmd.AddCommand(NewOpenCmd())
+	agentCmd.AddCommand(NewCopyCmd())
+	agentCmd.AddCommand(NewGitCloneCmd())
+	agentCmd.AddCommand(NewMountCmd())
+	agentCmd.AddCommand(NewSyncCmd())
+	agentCmd.AddCommand(NewDevContainerCmd())
 	return agentCmd
 }
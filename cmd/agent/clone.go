@@ -0,0 +1,74 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/2017fighting/devssh/pkg/agent/tunnelserver"
+	"github.com/loft-sh/devpod/pkg/agent/tunnel"
+	"github.com/loft-sh/devpod/pkg/extract"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+type GitCloneCmd struct {
+	Path       string
+	Repository string
+}
+
+func NewGitCloneCmd() *cobra.Command {
+	cmd := &GitCloneCmd{}
+	gitCloneCmd := &cobra.Command{
+		Use:   "git-clone",
+		Short: "Unpacks a repository the local machine cloned, talks to it through stdio",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, args []string) error {
+			return cmd.Run(context.Background())
+		},
+	}
+	gitCloneCmd.Flags().StringVar(&cmd.Path, "path", "", "The directory to clone into")
+	gitCloneCmd.Flags().StringVar(&cmd.Repository, "repository", "", "The url of origin for later fetches")
+	_ = gitCloneCmd.MarkFlagRequired("path")
+	return gitCloneCmd
+}
+
+func (cmd *GitCloneCmd) Run(ctx context.Context) error {
+	tunnelClient, err := tunnelserver.NewTunnelClient(os.Stdin, os.Stdout, true, ExitCodeIO)
+	if err != nil {
+		return fmt.Errorf("error creating tunnel client: %w", err)
+	}
+	log := tunnelserver.NewTunnelLogger(ctx, tunnelClient, false)
+
+	// never unpack over existing work
+	if entries, err := os.ReadDir(cmd.Path); err == nil && len(entries) > 0 {
+		return fmt.Errorf("%s already exists and is not empty", cmd.Path)
+	}
+	err = os.MkdirAll(cmd.Path, 0o755)
+	if err != nil {
+		return err
+	}
+
+	stream, err := tunnelClient.StreamGitClone(ctx, &tunnel.Empty{})
+	if err != nil {
+		return errors.Wrap(err, "local cloning")
+	}
+	err = extract.Extract(tunnelserver.NewStreamReader(stream, log), cmd.Path)
+	if err != nil {
+		_ = os.RemoveAll(cmd.Path)
+		return errors.Wrap(err, "unpack repository")
+	}
+
+	// fetches go to the repository directly and authenticate through the
+	// credential helper of devssh ssh sessions
+	if cmd.Repository != "" {
+		out, err := exec.Command("git", "-C", cmd.Path, "remote", "set-url", "origin", cmd.Repository).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("set origin: %s", strings.TrimSpace(string(out)))
+		}
+	}
+	log.Donef("Cloned into %s", cmd.Path)
+	return nil
+}
@@ -0,0 +1,64 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/2017fighting/devssh/pkg/agent/tunnelserver"
+	"github.com/2017fighting/devssh/pkg/devcontainer"
+	"github.com/2017fighting/devssh/pkg/kubernetes"
+	"github.com/loft-sh/devpod/pkg/agent/tunnel"
+	"github.com/loft-sh/devpod/pkg/devcontainer/config"
+	perrors "github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+type DevContainerCmd struct {
+	WorkspaceFolder string
+}
+
+func NewDevContainerCmd() *cobra.Command {
+	cmd := &DevContainerCmd{}
+	devContainerCmd := &cobra.Command{
+		Use:   "devcontainer",
+		Short: "Sends the devcontainer.json of the workspace to the local machine, talks to it through stdio",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, args []string) error {
+			return cmd.Run(context.Background())
+		},
+	}
+	devContainerCmd.Flags().StringVar(&cmd.WorkspaceFolder, "workspace-folder", kubernetes.WorkspaceMountPath, "The folder to look for the devcontainer.json in, its subdirectories are tried next")
+	return devContainerCmd
+}
+
+func (cmd *DevContainerCmd) Run(ctx context.Context) error {
+	tunnelClient, err := tunnelserver.NewTunnelClient(os.Stdin, os.Stdout, true, ExitCodeIO)
+	if err != nil {
+		return fmt.Errorf("error creating tunnel client: %w", err)
+	}
+	log := tunnelserver.NewTunnelLogger(ctx, tunnelClient, false)
+
+	result, err := devcontainer.Load(cmd.WorkspaceFolder, true)
+	if err != nil {
+		return err
+	} else if result == nil {
+		log.Debugf("No devcontainer.json found in %s", cmd.WorkspaceFolder)
+		return nil
+	}
+
+	// the folder it was found in is the workspace folder in the container
+	result.SubstitutionContext = &config.SubstitutionContext{
+		ContainerWorkspaceFolder: result.SubstitutionContext.LocalWorkspaceFolder,
+	}
+	out, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	_, err = tunnelClient.SendResult(ctx, &tunnel.Message{Message: string(out)})
+	if err != nil {
+		return perrors.Wrap(err, "send result")
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/2017fighting/devssh/pkg/agent"
+	"github.com/2017fighting/devssh/pkg/agent/tunnelserver"
+	"github.com/loft-sh/devpod/pkg/agent/tunnel"
+	"github.com/loft-sh/devpod/pkg/credentials"
+	"github.com/loft-sh/devpod/pkg/extract"
+	portpkg "github.com/loft-sh/devpod/pkg/port"
+	"github.com/loft-sh/log"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// scriptLocations are tried in order if no install script is given, like devpod does
+var scriptLocations = []string{
+	"install.sh",
+	"install",
+	"bootstrap.sh",
+	"bootstrap",
+	"script/bootstrap",
+	"setup.sh",
+	"setup",
+	"setup/setup",
+}
+
+// backupSuffix is appended to the files of the home directory replaced by a dotfile link
+const backupSuffix = ".devssh-backup"
+
+type DotfilesCmd struct {
+	Marker        string
+	Repository    string
+	InstallScript string
+}
+
+func NewDotfilesCmd() *cobra.Command {
+	cmd := &DotfilesCmd{}
+	dotfilesCmd := &cobra.Command{
+		Use:   "dotfiles",
+		Short: "Installs dotfiles from a git repository or a tar archive on stdin for the current user, talks to the local machine through stdio for a repository",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, args []string) error {
+			return cmd.Run(context.Background(), log.Default.ErrorStreamOnly())
+		},
+	}
+	dotfilesCmd.Flags().StringVar(&cmd.Marker, "marker", "", "The uid of the pod, recorded once the dotfiles are installed")
+	dotfilesCmd.Flags().StringVar(&cmd.Repository, "repository", "", "The git repository to clone with the credentials of the local machine, reads a tar archive from stdin if empty")
+	dotfilesCmd.Flags().StringVar(&cmd.InstallScript, "install-script", "", "The install script in the dotfiles, the known locations are tried if empty")
+	return dotfilesCmd
+}
+
+func (cmd *DotfilesCmd) Run(ctx context.Context, log log.Logger) error {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	targetDir := filepath.Join(home, agent.DotfilesDir)
+
+	if cmd.Repository != "" {
+		var tunnelClient tunnel.TunnelClient
+		tunnelClient, err = tunnelserver.NewTunnelClient(os.Stdin, os.Stdout, true, ExitCodeIO)
+		if err != nil {
+			return fmt.Errorf("error creating tunnel client: %w", err)
+		}
+		log = tunnelserver.NewTunnelLogger(ctx, tunnelClient, false)
+
+		// git asks the local machine for credentials through a credentials server of its own,
+		// the one of the session may not be up yet
+		var port int
+		port, err = credentials.GetPort()
+		if err != nil {
+			return err
+		}
+		port, err = portpkg.FindAvailablePort(port + 1)
+		if err != nil {
+			return err
+		}
+		serverCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			err := credentials.RunCredentialsServer(serverCtx, port, tunnelClient, log)
+			if err != nil {
+				log.Debugf("Error running credentials server: %v", err)
+			}
+		}()
+		err = cloneDotfiles(ctx, cmd.Repository, targetDir, port, log)
+	} else {
+		log.Infof("Copy dotfiles to %s", targetDir)
+		_ = os.RemoveAll(targetDir)
+		err = os.MkdirAll(targetDir, 0o755)
+		if err == nil {
+			err = extract.Extract(os.Stdin, targetDir)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("get dotfiles: %w", err)
+	}
+
+	err = cmd.install(targetDir, home, log)
+	if err != nil {
+		return err
+	}
+
+	if cmd.Marker != "" {
+		markerPath := filepath.Join(home, agent.DotfilesMarker)
+		err = os.MkdirAll(filepath.Dir(markerPath), 0o755)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(markerPath, []byte(cmd.Marker), 0o644)
+	}
+	return nil
+}
+
+// cloneDotfiles clones or updates the dotfiles in targetDir, which only devssh writes to
+func cloneDotfiles(ctx context.Context, repository string, targetDir string, port int, log log.Logger) error {
+	binaryPath, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	// the empty helper drops the ones of the user's git config
+	helper := []string{"-c", "credential.helper=", "-c", fmt.Sprintf("credential.helper=!'%s' agent git-credentials --port %d", binaryPath, port)}
+
+	if _, err := os.Stat(filepath.Join(targetDir, ".git")); err == nil {
+		log.Infof("Update dotfiles in %s", targetDir)
+		return runLogged(log, targetDir, "git", append(helper, "pull", "--ff-only")...)
+	}
+
+	// the credentials server is started alongside, so the first try may not reach it
+	log.Infof("Clone dotfiles %s", repository)
+	for i := 0; i < 3; i++ {
+		_ = os.RemoveAll(targetDir)
+		err = runLogged(log, "", "git", append(helper, "clone", "--depth", "1", repository, targetDir)...)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+	return err
+}
+
+func (cmd *DotfilesCmd) install(dir string, home string, log log.Logger) error {
+	if cmd.InstallScript != "" {
+		log.Infof("Run install script %s", cmd.InstallScript)
+		return runScript(log, dir, cmd.InstallScript)
+	}
+
+	for _, script := range scriptLocations {
+		if stat, err := os.Stat(filepath.Join(dir, script)); err != nil || stat.IsDir() {
+			continue
+		}
+		log.Infof("Run install script %s", script)
+		return runScript(log, dir, script)
+	}
+
+	// without a script the dotfiles are linked into the home directory
+	log.Infof("No install script found, link the dotfiles into %s", home)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), ".") || entry.IsDir() {
+			continue
+		}
+		target := filepath.Join(dir, entry.Name())
+		link := filepath.Join(home, entry.Name())
+		if current, err := os.Readlink(link); err == nil && current == target {
+			continue
+		}
+		// files the user already has are kept as a backup, the home may be persistent
+		if _, err := os.Lstat(link); err == nil {
+			backup := link + backupSuffix
+			if _, err := os.Lstat(backup); err == nil {
+				log.Warnf("Skip %s, it exists and so does its backup %s", link, backup)
+				continue
+			}
+			log.Infof("Move %s to %s", link, backup)
+			err = os.Rename(link, backup)
+			if err != nil {
+				return err
+			}
+		}
+		err = os.Symlink(target, link)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runScript(log log.Logger, dir string, script string) error {
+	path := filepath.Join(dir, script)
+	err := os.Chmod(path, 0o755)
+	if err != nil {
+		return fmt.Errorf("make install script executable: %w", err)
+	}
+	return runLogged(log, dir, path)
+}
+
+func runLogged(log log.Logger, dir string, name string, args ...string) error {
+	writer := log.Writer(logrus.InfoLevel, false)
+	defer writer.Close()
+
+	command := exec.Command(name, args...)
+	command.Dir = dir
+	command.Stdout = writer
+	command.Stderr = writer
+	return command.Run()
+}
@@ -0,0 +1,95 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/2017fighting/devssh/pkg/agent"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+type SetupGPGCmd struct {
+	Socket string
+}
+
+func NewSetupGPGCmd() *cobra.Command {
+	cmd := &SetupGPGCmd{}
+	setupGPGCmd := &cobra.Command{
+		Use:   "setup-gpg",
+		Short: "Imports the public keys for the forwarded gpg-agent of the current user",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, args []string) error {
+			return cmd.Run(context.Background(), log.Default.ErrorStreamOnly())
+		},
+	}
+	setupGPGCmd.Flags().StringVar(&cmd.Socket, "socket", "", "The path of the forwarded gpg-agent socket")
+	_ = setupGPGCmd.MarkFlagRequired("socket")
+	return setupGPGCmd
+}
+
+func (cmd *SetupGPGCmd) Run(ctx context.Context, log log.Logger) error {
+	stdin := bufio.NewReader(os.Stdin)
+	line, err := stdin.ReadBytes('\n')
+	if err != nil {
+		return fmt.Errorf("read gpg setup: %w", err)
+	}
+	setup := &agent.GPGSetup{}
+	err = json.Unmarshal(line, setup)
+	if err != nil {
+		return fmt.Errorf("decode gpg setup: %w", err)
+	}
+
+	// the keys are only needed to verify, the secret keys stay in the local agent
+	if len(setup.PublicKeys) > 0 {
+		err = runWithStdin(setup.PublicKeys, "gpg", "--batch", "--no-autostart", "--import")
+		if err != nil {
+			return fmt.Errorf("import public keys: %w", err)
+		}
+	}
+	if len(setup.OwnerTrust) > 0 {
+		err = runWithStdin(setup.OwnerTrust, "gpg", "--batch", "--no-autostart", "--import-ownertrust")
+		if err != nil {
+			return fmt.Errorf("import ownertrust: %w", err)
+		}
+	}
+
+	err = waitForSocket(ctx, cmd.Socket, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	log.Debugf("Forwarded gpg-agent is ready at %s", cmd.Socket)
+	return nil
+}
+
+func runWithStdin(stdin []byte, name string, args ...string) error {
+	command := exec.Command(name, args...)
+	command.Stdin = bytes.NewReader(stdin)
+	out, err := command.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func waitForSocket(ctx context.Context, path string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		if stat, err := os.Stat(path); err == nil && stat.Mode()&os.ModeSocket != 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("gpg-agent socket %s wasn't forwarded", path)
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+
+	"github.com/2017fighting/devssh/pkg/agent"
+	"github.com/spf13/cobra"
+)
+
+// NewOpenCmd returns the command the session uses as BROWSER and xdg-open
+func NewOpenCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "open URL",
+		Short: "Opens the url in the browser of the local machine of the session",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			target, err := url.Parse(args[0])
+			if err != nil || (target.Scheme != "http" && target.Scheme != "https") {
+				return fmt.Errorf("only http and https urls can be opened on the local machine, not %s", args[0])
+			}
+			return sendHostRequest(&agent.HostRequest{Action: agent.HostActionOpen, URL: args[0]})
+		},
+	}
+}
+
+func NewCopyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "copy",
+		Short: "Copies stdin to the clipboard of the local machine of the session",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, args []string) error {
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return err
+			}
+			return sendHostRequest(&agent.HostRequest{Action: agent.HostActionCopy, Data: data})
+		},
+	}
+}
+
+func sendHostRequest(request *agent.HostRequest) error {
+	socketPath := os.Getenv(agent.HostSocketEnv)
+	if socketPath == "" {
+		return fmt.Errorf("$%s is not set, connect with 'devssh ssh --forward-browser' or '--clipboard'", agent.HostSocketEnv)
+	}
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("connect to the local machine: %w", err)
+	}
+	defer conn.Close()
+
+	err = json.NewEncoder(conn).Encode(request)
+	if err != nil {
+		return err
+	}
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+	response := &agent.HostResponse{}
+	err = json.Unmarshal(line, response)
+	if err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	if response.Error != "" {
+		return fmt.Errorf("%s", response.Error)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+type KubeConfigCmd struct{}
+
+func NewKubeConfigCmd() *cobra.Command {
+	cmd := &KubeConfigCmd{}
+	kubeConfigCmd := &cobra.Command{
+		Use:   "kubeconfig",
+		Short: "Writes the kubeconfig from stdin to a file of the session until stdin is closed, prints the path of the file",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, args []string) error {
+			return cmd.Run(context.Background(), log.Default.ErrorStreamOnly())
+		},
+	}
+	return kubeConfigCmd
+}
+
+func (cmd *KubeConfigCmd) Run(ctx context.Context, log log.Logger) error {
+	stdin := bufio.NewReader(os.Stdin)
+	line, err := stdin.ReadBytes('\n')
+	if err != nil {
+		return fmt.Errorf("read kubeconfig: %w", err)
+	}
+	kubeConfig, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(line)))
+	if err != nil {
+		return fmt.Errorf("decode kubeconfig: %w", err)
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	// every session gets its own file, the kubeconfig of the container isn't touched
+	path := filepath.Join(home, ".kube", "devssh-"+strconv.Itoa(os.Getpid())+".config")
+	err = os.MkdirAll(filepath.Dir(path), 0o700)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(path, kubeConfig, 0o600)
+	if err != nil {
+		return fmt.Errorf("write kubeconfig: %w", err)
+	}
+	defer os.Remove(path)
+	log.Debugf("Wrote kubeconfig to %s", path)
+
+	// the session points KUBECONFIG at the file
+	_, err = fmt.Fprintln(os.Stdout, path)
+	if err != nil {
+		return err
+	}
+
+	// the session ends when stdin is closed
+	_, _ = io.Copy(io.Discard, stdin)
+	return nil
+}
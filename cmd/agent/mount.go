@@ -0,0 +1,155 @@
+package agent
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/2017fighting/devssh/pkg/agent/tunnelserver"
+	"github.com/loft-sh/devpod/pkg/agent/tunnel"
+	"github.com/loft-sh/devpod/pkg/devcontainer/config"
+	perrors "github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+type MountCmd struct {
+	Mount string
+}
+
+func NewMountCmd() *cobra.Command {
+	cmd := &MountCmd{}
+	mountCmd := &cobra.Command{
+		Use:   "mount",
+		Short: "Copies a local directory into the container, talks to the local machine through stdio",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, args []string) error {
+			return cmd.Run(context.Background())
+		},
+	}
+	mountCmd.Flags().StringVar(&cmd.Mount, "mount", "", "The mount to copy, in the format type=bind,src=...,dst=...")
+	_ = mountCmd.MarkFlagRequired("mount")
+	return mountCmd
+}
+
+func (cmd *MountCmd) Run(ctx context.Context) error {
+	tunnelClient, err := tunnelserver.NewTunnelClient(os.Stdin, os.Stdout, true, ExitCodeIO)
+	if err != nil {
+		return fmt.Errorf("error creating tunnel client: %w", err)
+	}
+	log := tunnelserver.NewTunnelLogger(ctx, tunnelClient, false)
+
+	mount := config.ParseMount(cmd.Mount)
+	if mount.Target == "" {
+		return fmt.Errorf("mount %s has no target", cmd.Mount)
+	}
+	err = os.MkdirAll(mount.Target, 0o755)
+	if err != nil {
+		return err
+	}
+
+	stream, err := tunnelClient.StreamMount(ctx, &tunnel.StreamMountRequest{Mount: cmd.Mount})
+	if err != nil {
+		return perrors.Wrap(err, "stream mount")
+	}
+	count, err := extractMount(tunnelserver.NewStreamReader(stream, log), mount.Target)
+	if err != nil {
+		return perrors.Wrapf(err, "unpack into %s", mount.Target)
+	}
+	log.Donef("Copied %d files to %s", count, mount.Target)
+	return nil
+}
+
+// extractMount unpacks the tar over the files in dir and returns the number of files.
+// Unlike extract.Extract it replaces existing symlinks, so a mount can be copied again
+// on every connect.
+func extractMount(reader io.Reader, dir string) (int, error) {
+	count := 0
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			return count, nil
+		} else if err != nil {
+			return count, err
+		}
+
+		name := filepath.FromSlash(header.Name)
+		if !filepath.IsLocal(name) {
+			return count, fmt.Errorf("invalid path %s", header.Name)
+		}
+		path := filepath.Join(dir, name)
+		err = mkdirParents(dir, name)
+		if err != nil {
+			return count, err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			// a symlink in place of the directory would be followed by its files
+			if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+				_ = os.Remove(path)
+			}
+			err = os.MkdirAll(path, header.FileInfo().Mode().Perm()|0o700)
+		case tar.TypeSymlink:
+			_ = os.Remove(path)
+			err = os.Symlink(header.Linkname, path)
+		case tar.TypeReg:
+			err = writeFile(path, tarReader, header)
+			count++
+		}
+		if err != nil {
+			return count, err
+		}
+	}
+}
+
+// mkdirParents creates the parent directories of the local path name below dir. The
+// existing ones are checked with Lstat, writing through a symlink among them could
+// change files outside of dir.
+func mkdirParents(dir string, name string) error {
+	parent := dir
+	for _, part := range strings.Split(filepath.Dir(name), string(filepath.Separator)) {
+		if part == "." {
+			continue
+		}
+		parent = filepath.Join(parent, part)
+		info, err := os.Lstat(parent)
+		if os.IsNotExist(err) {
+			err = os.Mkdir(parent, 0o755)
+		} else if err == nil && info.Mode()&os.ModeSymlink != 0 {
+			err = fmt.Errorf("%s is a symlink", parent)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeFile(path string, reader io.Reader, header *tar.Header) error {
+	// a symlink in place of the file would be followed
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		_ = os.Remove(path)
+	}
+
+	mode := header.FileInfo().Mode().Perm() | 0o600
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, reader)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	_ = os.Chmod(path, mode)
+	return os.Chtimes(path, header.ModTime, header.ModTime)
+}
@@ -0,0 +1,195 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/2017fighting/devssh/pkg/filesync"
+	"github.com/2017fighting/devssh/pkg/ignore"
+	"github.com/spf13/cobra"
+)
+
+type SyncCmd struct {
+	Path string
+}
+
+func NewSyncCmd() *cobra.Command {
+	cmd := &SyncCmd{}
+	syncCmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Watches a directory for devssh sync and applies its changes, talks to it through stdio",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, args []string) error {
+			return cmd.Run(context.Background())
+		},
+	}
+	syncCmd.Flags().StringVar(&cmd.Path, "path", "", "The directory to sync")
+	_ = syncCmd.MarkFlagRequired("path")
+	return syncCmd
+}
+
+func (cmd *SyncCmd) Run(ctx context.Context) error {
+	conn := filesync.NewConn(os.Stdin, os.Stdout)
+	init, err := conn.Receive()
+	if err != nil {
+		return err
+	} else if init.Type != filesync.MessageInit {
+		return fmt.Errorf("unexpected message %s", init.Type)
+	}
+	matcher, err := ignore.New(init.Patterns)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(cmd.Path, 0o755)
+	if err != nil {
+		return cmd.fail(conn, err)
+	}
+	entries, large, err := filesync.Scan(cmd.Path, matcher)
+	if err != nil {
+		return cmd.fail(conn, err)
+	}
+	root, err := filesync.RootID(cmd.Path)
+	if err != nil {
+		return cmd.fail(conn, err)
+	}
+	index := &filesync.Message{Type: filesync.MessageIndex, Root: root, Paths: large}
+	for _, entry := range entries {
+		index.Entries = append(index.Entries, entry)
+	}
+	sort.Slice(index.Entries, func(i, j int) bool {
+		return index.Entries[i].Path < index.Entries[j].Path
+	})
+	err = conn.Send(index)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	applied := &appliedSums{sums: map[string]string{}}
+	watchErr := make(chan error, 1)
+	go func() {
+		watchErr <- filesync.Watch(ctx, cmd.Path, matcher, func(paths []string) {
+			cmd.sendChanges(conn, paths, applied)
+		})
+	}()
+
+	messages := make(chan *filesync.Message)
+	receiveErr := make(chan error, 1)
+	go func() {
+		for {
+			message, err := conn.Receive()
+			if err != nil {
+				receiveErr <- err
+				return
+			}
+			select {
+			case messages <- message:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for {
+		var message *filesync.Message
+		select {
+		case err := <-watchErr:
+			// devssh sync connects again and compares everything
+			return fmt.Errorf("watch %s: %w", cmd.Path, err)
+		case err := <-receiveErr:
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		case message = <-messages:
+		}
+
+		switch message.Type {
+		case filesync.MessageGet:
+			go cmd.sendChanges(conn, message.Paths, nil)
+		case filesync.MessageChange:
+			err = cmd.applyChange(conn, message, applied)
+			if err != nil {
+				_ = conn.Send(&filesync.Message{Type: filesync.MessageError, Path: message.Path, Base: message.Base, Error: err.Error()})
+			}
+		}
+	}
+}
+
+// applyChange applies a change of devssh sync if the entry at its path is still the one
+// the change is based on, otherwise it answers with the current entry
+func (cmd *SyncCmd) applyChange(conn *filesync.Conn, message *filesync.Message, applied *appliedSums) error {
+	current, data, err := filesync.Read(cmd.Path, message.Path)
+	if err != nil {
+		return err
+	}
+	if sum := current.Sum(); sum != message.Base && sum != message.Entry.Sum() {
+		return conn.Send(&filesync.Message{Type: filesync.MessageConflict, Path: message.Path, Base: message.Base, Entry: current, Data: data})
+	}
+
+	applied.set(message.Path, message.Entry.Sum())
+	if message.Entry == nil {
+		err = filesync.Remove(cmd.Path, message.Path)
+	} else {
+		err = filesync.Apply(cmd.Path, message.Entry, message.Data)
+	}
+	if err != nil {
+		applied.echo(message.Path, "")
+		return err
+	}
+	return conn.Send(&filesync.Message{Type: filesync.MessageApplied, Path: message.Path, Base: message.Base})
+}
+
+// sendChanges sends the entries at paths, except the ones the agent applied itself
+func (cmd *SyncCmd) sendChanges(conn *filesync.Conn, paths []string, applied *appliedSums) {
+	for _, path := range paths {
+		entry, data, err := filesync.Read(cmd.Path, path)
+		if errors.Is(err, filesync.ErrTooLarge) {
+			_ = conn.Send(&filesync.Message{Type: filesync.MessageLarge, Path: path})
+			continue
+		} else if err != nil {
+			_ = conn.Send(&filesync.Message{Type: filesync.MessageError, Path: path, Error: err.Error()})
+			continue
+		} else if applied != nil && applied.echo(path, entry.Sum()) {
+			continue
+		}
+		err = conn.Send(&filesync.Message{Type: filesync.MessageChange, Path: path, Entry: entry, Data: data})
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (cmd *SyncCmd) fail(conn *filesync.Conn, err error) error {
+	_ = conn.Send(&filesync.Message{Type: filesync.MessageError, Error: err.Error()})
+	return err
+}
+
+// appliedSums are the sums of the changes the agent applied, the watcher doesn't send
+// them back
+type appliedSums struct {
+	m    sync.Mutex
+	sums map[string]string
+}
+
+func (a *appliedSums) set(path string, sum string) {
+	a.m.Lock()
+	defer a.m.Unlock()
+	a.sums[path] = sum
+}
+
+// echo reports whether sum is the one applied at path, the path is forgotten after
+func (a *appliedSums) echo(path string, sum string) bool {
+	a.m.Lock()
+	defer a.m.Unlock()
+	applied, ok := a.sums[path]
+	delete(a.sums, path)
+	return ok && applied == sum
+}
@@ -0,0 +1,110 @@
+package completion
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/2017fighting/devssh/pkg/kubernetes"
+	"github.com/spf13/cobra"
+)
+
+// completionTimeout bounds the k8s api calls, so slow clusters don't freeze the shell
+const completionTimeout = 3 * time.Second
+
+// devssh completion --
+func NewCompletionCmd() *cobra.Command {
+	completionCmd := &cobra.Command{
+		Use:   "completion [bash|zsh|fish|powershell]",
+		Short: "Generates the shell completion script",
+		Long: `Generates the shell completion script for devssh.
+
+To load completions in the current shell session:
+
+  bash:       source <(devssh completion bash)
+  zsh:        source <(devssh completion zsh)
+  fish:       devssh completion fish | source
+  powershell: devssh completion powershell | Out-String | Invoke-Expression
+`,
+		ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+		Args:                  cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+		DisableFlagsInUseLine: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root := cmd.Root()
+			switch args[0] {
+			case "bash":
+				return root.GenBashCompletionV2(os.Stdout, true)
+			case "zsh":
+				return root.GenZshCompletion(os.Stdout)
+			case "fish":
+				return root.GenFishCompletion(os.Stdout, true)
+			case "powershell":
+				return root.GenPowerShellCompletionWithDesc(os.Stdout)
+			default:
+				return fmt.Errorf("unsupported shell %s", args[0])
+			}
+		},
+	}
+	return completionCmd
+}
+
+// RegisterFlagCompletions adds cluster backed completions to the --context, --ns,
+// --svc, --container and --user flags of the command, flags it doesn't have are skipped
+func RegisterFlagCompletions(cmd *cobra.Command) {
+	register := func(flag string, fn func(ctx context.Context, cmd *cobra.Command) ([]string, error)) {
+		if cmd.Flags().Lookup(flag) == nil && cmd.PersistentFlags().Lookup(flag) == nil {
+			return
+		}
+		_ = cmd.RegisterFlagCompletionFunc(flag, func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return complete(cmd, fn)
+		})
+	}
+
+	register("context", func(ctx context.Context, cmd *cobra.Command) ([]string, error) {
+		return kubernetes.ListContexts()
+	})
+	register("ns", func(ctx context.Context, cmd *cobra.Command) ([]string, error) {
+		return kubernetes.ListNamespaces(ctx)
+	})
+	register("svc", func(ctx context.Context, cmd *cobra.Command) ([]string, error) {
+		return kubernetes.ListServices(ctx, flagValue(cmd, "ns"))
+	})
+	register("container", func(ctx context.Context, cmd *cobra.Command) ([]string, error) {
+		return kubernetes.ListContainers(ctx, flagValue(cmd, "ns"), flagValue(cmd, "svc"))
+	})
+	register("user", func(ctx context.Context, cmd *cobra.Command) ([]string, error) {
+		return kubernetes.ListUsers(ctx, flagValue(cmd, "ns"), flagValue(cmd, "svc"), flagValue(cmd, "container"))
+	})
+}
+
+func complete(cmd *cobra.Command, fn func(ctx context.Context, cmd *cobra.Command) ([]string, error)) (names []string, directive cobra.ShellCompDirective) {
+	ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+	defer cancel()
+
+	// the root command hooks don't run for completions
+	kubernetes.SetContext(flagValue(cmd, "context"))
+
+	// the k8s client panics on a broken kubeconfig, which must not end up in the shell
+	defer func() {
+		if r := recover(); r != nil {
+			cobra.CompDebugln(fmt.Sprintf("completion failed: %v", r), false)
+			names, directive = nil, cobra.ShellCompDirectiveNoFileComp
+		}
+	}()
+
+	names, err := fn(ctx, cmd)
+	if err != nil {
+		cobra.CompDebugln(fmt.Sprintf("completion failed: %v", err), false)
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+func flagValue(cmd *cobra.Command, name string) string {
+	flag := cmd.Flags().Lookup(name)
+	if flag == nil {
+		return ""
+	}
+	return flag.Value.String()
+}
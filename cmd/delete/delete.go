@@ -0,0 +1,59 @@
+package deletecmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/2017fighting/devssh/cmd/completion"
+	"github.com/2017fighting/devssh/pkg/client"
+	"github.com/2017fighting/devssh/pkg/kubernetes"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+type DeleteCmd struct {
+	NameSpace    string
+	Service      string
+	DeleteVolume bool
+}
+
+// devssh delete --
+func NewDeleteCmd() *cobra.Command {
+	cmd := &DeleteCmd{}
+	deleteCmd := &cobra.Command{
+		Use:   "delete",
+		Short: "Deletes a workspace created by devssh up",
+		RunE: func(_ *cobra.Command, args []string) error {
+			ctx := context.Background()
+			return cmd.Run(ctx, log.Default.ErrorStreamOnly())
+		},
+	}
+	deleteCmd.Flags().StringVar(&cmd.NameSpace, "ns", "", "The k8s namespace of the workspace")
+	deleteCmd.Flags().StringVar(&cmd.Service, "svc", "", "The k8s service of the workspace")
+	deleteCmd.Flags().BoolVar(&cmd.DeleteVolume, "delete-volume", false, "Also delete the persistent volume of the workspace")
+	completion.RegisterFlagCompletions(deleteCmd)
+	return deleteCmd
+}
+
+func (cmd *DeleteCmd) Run(ctx context.Context, log log.Logger) error {
+	if cmd.NameSpace == "" {
+		return fmt.Errorf("please specify k8s namespace")
+	}
+	if cmd.Service == "" {
+		return fmt.Errorf("please specify k8s service")
+	}
+
+	client := client.NewWorkspaceClient(cmd.NameSpace, cmd.Service, log)
+	err := client.Lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Unlock()
+
+	err = kubernetes.DeleteWorkspace(ctx, cmd.NameSpace, cmd.Service, cmd.DeleteVolume, log)
+	if err != nil {
+		return err
+	}
+	log.Donef("Deleted workspace %s/%s", cmd.NameSpace, cmd.Service)
+	return nil
+}
@@ -0,0 +1,93 @@
+package list
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/2017fighting/devssh/cmd/completion"
+	"github.com/2017fighting/devssh/pkg/kubernetes"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"sigs.k8s.io/yaml"
+)
+
+type ListCmd struct {
+	NameSpace      string
+	WorkspacesOnly bool
+	CheckDevSSH    bool
+	Output         string
+}
+
+// devssh list --
+func NewListCmd() *cobra.Command {
+	cmd := &ListCmd{}
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "Lists the services that can be connected to",
+		RunE: func(_ *cobra.Command, args []string) error {
+			ctx := context.Background()
+			return cmd.Run(ctx, os.Stdout, log.Default.ErrorStreamOnly())
+		},
+	}
+	listCmd.Flags().StringVar(&cmd.NameSpace, "ns", "", "The k8s namespace to list, all namespaces if empty")
+	listCmd.Flags().BoolVar(&cmd.WorkspacesOnly, "workspaces-only", false, "Only list workspaces created by devssh up")
+	listCmd.Flags().BoolVar(&cmd.CheckDevSSH, "check-devssh", false, "Exec into the ready pods to check if devssh is installed, otherwise the DEVSSH column is unknown")
+	listCmd.Flags().StringVarP(&cmd.Output, "output", "o", "table", "The output format, one of table, json or yaml")
+	completion.RegisterFlagCompletions(listCmd)
+	return listCmd
+}
+
+func (cmd *ListCmd) Run(ctx context.Context, out io.Writer, log log.Logger) error {
+	workspaces, err := kubernetes.ListWorkspaces(ctx, kubernetes.ListOptions{
+		Namespace:      cmd.NameSpace,
+		WorkspacesOnly: cmd.WorkspacesOnly,
+		CheckDevSSH:    cmd.CheckDevSSH,
+	})
+	if err != nil {
+		return err
+	}
+
+	switch cmd.Output {
+	case "json":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(workspaces)
+	case "yaml":
+		raw, err := yaml.Marshal(workspaces)
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(raw)
+		return err
+	case "table":
+		return printTable(out, workspaces)
+	default:
+		return fmt.Errorf("unknown output format %s, expected table, json or yaml", cmd.Output)
+	}
+}
+
+func printTable(out io.Writer, workspaces []kubernetes.WorkspaceSummary) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tSERVICE\tREADY\tAGE\tDEVSSH\tIMAGE")
+	for _, workspace := range workspaces {
+		age := "-"
+		if !workspace.Created.IsZero() {
+			age = duration.HumanDuration(time.Since(workspace.Created))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d/%d\t%s\t%s\t%s\n",
+			workspace.Namespace,
+			workspace.Service,
+			workspace.Ready, workspace.Pods,
+			age,
+			workspace.DevSSH,
+			workspace.Image,
+		)
+	}
+	return w.Flush()
+}
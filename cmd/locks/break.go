@@ -0,0 +1,79 @@
+package locks
+
+import (
+	"fmt"
+
+	"github.com/2017fighting/devssh/cmd/completion"
+	"github.com/2017fighting/devssh/pkg/client"
+	"github.com/2017fighting/devssh/pkg/kubernetes"
+	"github.com/2017fighting/devssh/pkg/provider"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+type BreakCmd struct {
+	NameSpace string
+	Service   string
+	AllStale  bool
+	Force     bool
+}
+
+func NewBreakCmd() *cobra.Command {
+	cmd := &BreakCmd{}
+	breakCmd := &cobra.Command{
+		Use:   "break",
+		Short: "Breaks the lock of a workspace, e.g. one left behind by a killed devssh",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, args []string) error {
+			return cmd.Run(log.Default.ErrorStreamOnly())
+		},
+	}
+	breakCmd.Flags().StringVar(&cmd.NameSpace, "ns", "", "The k8s namespace of the workspace")
+	breakCmd.Flags().StringVar(&cmd.Service, "svc", "", "The k8s service of the workspace")
+	breakCmd.Flags().BoolVar(&cmd.AllStale, "all-stale", false, "Break all locks whose holder is gone, the processes that inherited them are terminated")
+	breakCmd.Flags().BoolVar(&cmd.Force, "force", false, "Break the lock even if its holder is still running, the holder is terminated")
+	completion.RegisterFlagCompletions(breakCmd)
+	return breakCmd
+}
+
+func (cmd *BreakCmd) Run(log log.Logger) error {
+	if cmd.AllStale {
+		locks, err := client.ListLocks()
+		if err != nil {
+			return err
+		}
+		for _, lock := range locks {
+			if lock.State != client.LockStale {
+				continue
+			}
+			err = client.BreakLock(lock.Dir, false)
+			if err != nil {
+				log.Warnf("Break lock of %s/%s: %v", lock.Namespace, lock.Service, err)
+				continue
+			}
+			log.Donef("Broke lock of %s/%s left behind by %s", lock.Namespace, lock.Service, lock.Holders[0])
+		}
+		return nil
+	}
+
+	if cmd.NameSpace == "" {
+		return fmt.Errorf("please specify k8s namespace")
+	}
+	if cmd.Service == "" {
+		return fmt.Errorf("please specify k8s service")
+	}
+	kubeContext, err := kubernetes.CurrentContext()
+	if err != nil {
+		return err
+	}
+	dir, err := provider.GetLocksDir(kubeContext, cmd.NameSpace, cmd.Service)
+	if err != nil {
+		return err
+	}
+	err = client.BreakLock(dir, cmd.Force)
+	if err != nil {
+		return err
+	}
+	log.Donef("Broke lock of %s/%s", cmd.NameSpace, cmd.Service)
+	return nil
+}
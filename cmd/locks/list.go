@@ -0,0 +1,64 @@
+package locks
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/2017fighting/devssh/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+type ListCmd struct {
+	Output string
+}
+
+func NewListCmd() *cobra.Command {
+	cmd := &ListCmd{}
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "Lists the workspace locks and who holds them",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, args []string) error {
+			return cmd.Run()
+		},
+	}
+	listCmd.Flags().StringVarP(&cmd.Output, "output", "o", "table", "The output format, table or json")
+	return listCmd
+}
+
+func (cmd *ListCmd) Run() error {
+	locks, err := client.ListLocks()
+	if err != nil {
+		return err
+	}
+
+	switch cmd.Output {
+	case "json":
+		raw, err := json.MarshalIndent(locks, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(raw))
+		return nil
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "CONTEXT\tNAMESPACE\tSERVICE\tSTATE\tMODE\tPID\tSINCE\tCOMMAND")
+		for _, lock := range locks {
+			if len(lock.Holders) == 0 {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\t\t\t\n", lock.Context, lock.Namespace, lock.Service, lock.State)
+				continue
+			}
+			// a shared lock has a row per session holding it
+			for _, holder := range lock.Holders {
+				since := time.Since(holder.Started).Round(time.Second).String()
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n", lock.Context, lock.Namespace, lock.Service, lock.State, holder.Mode, holder.PID, since, holder.Command)
+			}
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown output format %s, use table or json", cmd.Output)
+	}
+}
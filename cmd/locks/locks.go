@@ -0,0 +1,13 @@
+package locks
+
+import "github.com/spf13/cobra"
+
+func NewLocksCmd() *cobra.Command {
+	locksCmd := &cobra.Command{
+		Use:   "locks",
+		Short: "Shows and breaks the local workspace locks",
+	}
+	locksCmd.AddCommand(NewListCmd())
+	locksCmd.AddCommand(NewBreakCmd())
+	return locksCmd
+}
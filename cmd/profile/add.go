@@ -0,0 +1,126 @@
+package profile
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/2017fighting/devssh/cmd/completion"
+	"github.com/2017fighting/devssh/pkg/profile"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+type AddCmd struct {
+	profile.Profile
+}
+
+func NewAddCmd() *cobra.Command {
+	cmd := &AddCmd{}
+	forwardAgent := true
+	addCmd := &cobra.Command{
+		Use:   "add NAME",
+		Short: "Adds or replaces a profile",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			// the kube context is a persistent flag of the root command
+			cmd.Context = c.Flags().Lookup("context").Value.String()
+			if c.Flags().Changed("forward-agent") {
+				cmd.ForwardAgent = &forwardAgent
+			}
+			return cmd.Run(args[0], log.Default.ErrorStreamOnly())
+		},
+	}
+	addCmd.Flags().StringVar(&cmd.Namespace, "ns", "", "The k8s namespace of the container")
+	addCmd.Flags().StringVar(&cmd.Service, "svc", "", "The k8s service of the container")
+	addCmd.Flags().StringVar(&cmd.Container, "container", "", "The container of the pod to connect to")
+	addCmd.Flags().StringVar(&cmd.User, "user", "", "The user of the pod to use")
+	addCmd.Flags().StringVar(&cmd.DebugImage, "debug-image", "", "Attach an ephemeral debug container with this image")
+	addCmd.Flags().BoolVar(&cmd.Wait, "wait", false, "Wait until the pod is ready")
+	addCmd.Flags().StringVar(&cmd.WaitTimeout, "wait-timeout", "", "How long to wait for a ready pod with --wait")
+	addCmd.Flags().StringArrayVarP(&cmd.Forwards, "forward", "L", []string{}, "Forward a local port to the container, in the format [bind_address:]port:host:hostport")
+	addCmd.Flags().StringArrayVarP(&cmd.Dynamic, "dynamic-forward", "D", []string{}, "Run a local SOCKS5 proxy into the network of the pod, in the format [bind_address:]port")
+	addCmd.Flags().StringArrayVar(&cmd.Mounts, "mount", []string{}, "Copy a local directory into the container on connect, in the format local_dir:remote_dir")
+	addCmd.Flags().StringArrayVar(&cmd.Env, "env", []string{}, "Set an environment variable in the container, in the format KEY=VALUE")
+	addCmd.Flags().StringArrayVar(&cmd.SendEnv, "send-env", []string{}, "Send the local environment variables matching this glob pattern")
+	addCmd.Flags().StringVar(&cmd.EnvFile, "env-file", "", "Send the environment variables of this file")
+	addCmd.Flags().BoolVar(&cmd.ForwardKube, "forward-kubeconfig", false, "Write the kubeconfig of the context to the container")
+	addCmd.Flags().BoolVar(&cmd.ForwardGPG, "gpg-agent-forwarding", false, "Forward the local gpg-agent")
+	addCmd.Flags().BoolVarP(&cmd.ForwardX11, "forward-x11", "X", false, "Forward X11 connections to the local $DISPLAY")
+	addCmd.Flags().BoolVar(&cmd.Browser, "forward-browser", false, "Open the urls the container opens in the local browser")
+	addCmd.Flags().BoolVar(&cmd.Clipboard, "clipboard", false, "Copy to the local clipboard from the container")
+	addCmd.Flags().StringVar(&cmd.Dotfiles, "dotfiles", "", "The git repository with dotfiles to install")
+	addCmd.Flags().StringVar(&cmd.DotfilesDir, "dotfiles-dir", "", "The local directory with dotfiles to install")
+	addCmd.Flags().StringVar(&cmd.DotfilesScript, "dotfiles-script", "", "The install script in the dotfiles")
+	addCmd.Flags().BoolVar(&forwardAgent, "forward-agent", true, "Forward the local ssh-agent")
+	addCmd.Flags().BoolVar(&cmd.NoAddKeys, "no-add-keys", false, "Don't add the private keys of ~/.ssh to the local ssh-agent")
+	addCmd.Flags().StringArrayVar(&cmd.Identities, "identity", []string{}, "Only forward this key of the ssh-agent, a fingerprint or a key file")
+	addCmd.Flags().BoolVar(&cmd.AgentConfirm, "agent-confirm", false, "Ask through SSH_ASKPASS before a forwarded key is used")
+	addCmd.Flags().BoolVar(&cmd.Multiplex, "multiplex", false, "Share one connection to the container between invocations")
+	addCmd.Flags().StringVar(&cmd.ControlPersist, "control-persist", "", "How long the master process of --multiplex keeps the connection without sessions")
+	addCmd.Flags().BoolVar(&cmd.NoDevContainer, "no-devcontainer", false, "Don't apply the devcontainer.json of the local repository or the workspace in the pod")
+	completion.RegisterFlagCompletions(addCmd)
+	return addCmd
+}
+
+func (cmd *AddCmd) Run(name string, log log.Logger) error {
+	if cmd.Namespace == "" {
+		return fmt.Errorf("please specify k8s namespace")
+	}
+	if cmd.Service == "" {
+		return fmt.Errorf("please specify k8s service")
+	}
+
+	// the profile may be used from another directory
+	if cmd.EnvFile != "" {
+		envFile, err := filepath.Abs(cmd.EnvFile)
+		if err != nil {
+			return err
+		}
+		cmd.EnvFile = envFile
+	}
+	if cmd.DotfilesDir != "" {
+		dotfilesDir, err := filepath.Abs(cmd.DotfilesDir)
+		if err != nil {
+			return err
+		}
+		cmd.DotfilesDir = dotfilesDir
+	}
+	for i, mount := range cmd.Mounts {
+		index := strings.LastIndex(mount, ":")
+		if index <= 0 {
+			return fmt.Errorf("invalid mount %s, expected local_dir:remote_dir", mount)
+		}
+		source, err := filepath.Abs(mount[:index])
+		if err != nil {
+			return err
+		}
+		cmd.Mounts[i] = source + mount[index:]
+	}
+	for i, identity := range cmd.Identities {
+		if strings.HasPrefix(identity, "SHA256:") || strings.HasPrefix(identity, "MD5:") {
+			continue
+		}
+		path, err := filepath.Abs(identity)
+		if err != nil {
+			return err
+		}
+		cmd.Identities[i] = path
+	}
+
+	config, err := profile.Load()
+	if err != nil {
+		return err
+	}
+	if config.Profiles == nil {
+		config.Profiles = map[string]*profile.Profile{}
+	}
+	config.Profiles[name] = &cmd.Profile
+
+	err = profile.Save(config)
+	if err != nil {
+		return err
+	}
+	log.Donef("Saved profile %s, connect with 'devssh ssh %s'", name, name)
+	return nil
+}
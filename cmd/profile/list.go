@@ -0,0 +1,33 @@
+package profile
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/2017fighting/devssh/pkg/profile"
+	"github.com/spf13/cobra"
+)
+
+func NewListCmd() *cobra.Command {
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "Lists the profiles",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, args []string) error {
+			config, err := profile.Load()
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tCONTEXT\tNAMESPACE\tSERVICE\tCONTAINER\tUSER")
+			for _, name := range config.Names() {
+				p := config.Profiles[name]
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", name, p.Context, p.Namespace, p.Service, p.Container, p.User)
+			}
+			return w.Flush()
+		},
+	}
+	return listCmd
+}
@@ -0,0 +1,14 @@
+package profile
+
+import "github.com/spf13/cobra"
+
+func NewProfileCmd() *cobra.Command {
+	profileCmd := &cobra.Command{
+		Use:   "profile",
+		Short: "Manages named connection profiles for devssh ssh",
+	}
+	profileCmd.AddCommand(NewAddCmd())
+	profileCmd.AddCommand(NewListCmd())
+	profileCmd.AddCommand(NewRemoveCmd())
+	return profileCmd
+}
@@ -0,0 +1,43 @@
+package profile
+
+import (
+	"fmt"
+
+	"github.com/2017fighting/devssh/pkg/profile"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+func NewRemoveCmd() *cobra.Command {
+	removeCmd := &cobra.Command{
+		Use:     "rm NAME",
+		Aliases: []string{"remove"},
+		Short:   "Removes a profile",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			config, err := profile.Load()
+			if err != nil {
+				return err
+			}
+			if _, ok := config.Profiles[args[0]]; !ok {
+				return fmt.Errorf("profile %s not found", args[0])
+			}
+
+			delete(config.Profiles, args[0])
+			err = profile.Save(config)
+			if err != nil {
+				return err
+			}
+			log.Default.Donef("Removed profile %s", args[0])
+			return nil
+		},
+		ValidArgsFunction: func(_ *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+			config, err := profile.Load()
+			if err != nil || len(args) > 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return config.Names(), cobra.ShellCompDirectiveNoFileComp
+		},
+	}
+	return removeCmd
+}
@@ -5,21 +5,52 @@ import (
 	"os/exec"
 
 	"github.com/2017fighting/devssh/cmd/agent"
+	"github.com/2017fighting/devssh/cmd/completion"
+	deletecmd "github.com/2017fighting/devssh/cmd/delete"
+	"github.com/2017fighting/devssh/cmd/list"
+	"github.com/2017fighting/devssh/cmd/locks"
+	"github.com/2017fighting/devssh/cmd/profile"
 	ssh2 "github.com/2017fighting/devssh/cmd/ssh"
 	sshserver "github.com/2017fighting/devssh/cmd/ssh-server"
+	"github.com/2017fighting/devssh/cmd/start"
+	"github.com/2017fighting/devssh/cmd/status"
+	"github.com/2017fighting/devssh/cmd/stop"
+	"github.com/2017fighting/devssh/cmd/up"
+	"github.com/2017fighting/devssh/pkg/kubernetes"
 	log2 "github.com/loft-sh/log"
 	"github.com/spf13/cobra"
 	"golang.org/x/crypto/ssh"
 )
 
 func buildRoot() *cobra.Command {
+	var kubeContext string
 	cmd := &cobra.Command{
 		Use:           "devssh",
 		Short:         "DevSSH",
 		SilenceUsage:  true,
 		SilenceErrors: true,
+		// replaced by our own completion command
+		CompletionOptions: cobra.CompletionOptions{DisableDefaultCmd: true},
+		PersistentPreRun: func(_ *cobra.Command, _ []string) {
+			kubernetes.SetContext(kubeContext)
+		},
 	}
+	cmd.PersistentFlags().StringVar(&kubeContext, "context", "", "The kube context to use, defaults to the current context")
+	completion.RegisterFlagCompletions(cmd)
 	cmd.AddCommand(ssh2.NewSSHCmd())
+	cmd.AddCommand(ssh2.NewMasterCmd())
+	cmd.AddCommand(ssh2.NewProxyCmd())
+	cmd.AddCommand(ssh2.NewCloneCmd())
+	cmd.AddCommand(ssh2.NewSyncCmd())
+	cmd.AddCommand(up.NewUpCmd())
+	cmd.AddCommand(start.NewStartCmd())
+	cmd.AddCommand(stop.NewStopCmd())
+	cmd.AddCommand(status.NewStatusCmd())
+	cmd.AddCommand(list.NewListCmd())
+	cmd.AddCommand(profile.NewProfileCmd())
+	cmd.AddCommand(deletecmd.NewDeleteCmd())
+	cmd.AddCommand(locks.NewLocksCmd())
+	cmd.AddCommand(completion.NewCompletionCmd())
 	cmd.AddCommand(sshserver.NewSSHServerCmd())
 	cmd.AddCommand(agent.NewAgentCmd())
 	return cmd
@@ -4,16 +4,21 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/loft-sh/log"
 	"github.com/loft-sh/ssh"
 
-	helperssh "github.com/loft-sh/devpod/pkg/ssh/server"
+	helperssh "github.com/2017fighting/devssh/pkg/ssh/server"
 	"github.com/loft-sh/devpod/pkg/stdio"
 	"github.com/spf13/cobra"
 )
 
+// AcceptEnvVar lists additional variables the ssh-server accepts, comma separated
+const AcceptEnvVar = "DEVSSH_ACCEPT_ENV"
+
 type SSHServerCmd struct {
+	AcceptEnv []string
 }
 
 func NewSSHServerCmd() *cobra.Command {
@@ -26,6 +31,7 @@ func NewSSHServerCmd() *cobra.Command {
 			return cmd.Run(ctx)
 		},
 	}
+	sshServerCmd.Flags().StringSliceVar(&cmd.AcceptEnv, "accept-env", []string{}, "Glob patterns of the environment variables clients may set, in addition to the locale ones and $"+AcceptEnvVar)
 
 	return sshServerCmd
 
@@ -36,7 +42,12 @@ func (c *SSHServerCmd) Run(ctx context.Context) error {
 		keys    []ssh.PublicKey
 		hostKey []byte
 	)
-	server, err := helperssh.NewServer("0.0.0.0:8022", hostKey, keys, filepath.Join("/workspaces"), log.Default.ErrorStreamOnly())
+
+	acceptEnv := c.AcceptEnv
+	if value := os.Getenv(AcceptEnvVar); value != "" {
+		acceptEnv = append(acceptEnv, strings.Split(value, ",")...)
+	}
+	server, err := helperssh.NewServer("0.0.0.0:8022", hostKey, keys, filepath.Join("/workspaces"), log.Default.ErrorStreamOnly(), helperssh.WithAcceptEnv(acceptEnv))
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,176 @@
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+
+	devsshagent "github.com/loft-sh/devpod/pkg/ssh/agent"
+	"github.com/loft-sh/log"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// forwardAgent forwards the local ssh-agent to the session. With --identity or
+// --agent-confirm the container only talks to a restricted agent in between.
+func (cmd *SSHCmd) forwardAgent(sshClient *ssh.Client, session *ssh.Session, log log.Logger) error {
+	authSock := devsshagent.GetSSHAuthSocket()
+	if authSock == "" {
+		log.Debugf("SSH_AUTH_SOCK is not set, skip agent forwarding")
+		return nil
+	}
+
+	if len(cmd.Identities) == 0 && !cmd.AgentConfirm {
+		err := devsshagent.ForwardToRemote(sshClient, authSock)
+		if err != nil {
+			return fmt.Errorf("forward agent: %w", err)
+		}
+	} else {
+		restricted, err := cmd.newRestrictedAgent(authSock)
+		if err != nil {
+			return err
+		}
+		err = agent.ForwardToAgent(sshClient, restricted)
+		if err != nil {
+			return fmt.Errorf("forward agent: %w", err)
+		}
+	}
+
+	err := devsshagent.RequestAgentForwarding(session)
+	if err != nil {
+		return fmt.Errorf("request agent forwarding: %w", err)
+	}
+	log.Debugf("Forwarded ssh-agent %s", authSock)
+	return nil
+}
+
+func (cmd *SSHCmd) newRestrictedAgent(authSock string) (*restrictedAgent, error) {
+	if cmd.AgentConfirm && os.Getenv("SSH_ASKPASS") == "" {
+		return nil, fmt.Errorf("--agent-confirm needs SSH_ASKPASS to ask for confirmation")
+	}
+
+	fingerprints := map[string]bool{}
+	for _, identity := range cmd.Identities {
+		fingerprint, err := identityFingerprint(identity)
+		if err != nil {
+			return nil, err
+		}
+		fingerprints[fingerprint] = true
+	}
+
+	conn, err := net.Dial("unix", authSock)
+	if err != nil {
+		return nil, fmt.Errorf("connect to ssh-agent: %w", err)
+	}
+	return &restrictedAgent{
+		ExtendedAgent: agent.NewClient(conn),
+		fingerprints:  fingerprints,
+		confirm:       cmd.AgentConfirm,
+	}, nil
+}
+
+// identityFingerprint returns the SHA256 fingerprint of an --identity, which is
+// either a fingerprint or a public or private key file
+func identityFingerprint(identity string) (string, error) {
+	if strings.HasPrefix(identity, "SHA256:") || strings.HasPrefix(identity, "MD5:") {
+		return identity, nil
+	}
+
+	raw, err := os.ReadFile(identity)
+	if err != nil {
+		return "", fmt.Errorf("read identity: %w", err)
+	}
+	if key, _, _, _, err := ssh.ParseAuthorizedKey(raw); err == nil {
+		return ssh.FingerprintSHA256(key), nil
+	}
+	// prefer the public key, so encrypted private keys don't need a passphrase
+	if raw, err := os.ReadFile(identity + ".pub"); err == nil {
+		if key, _, _, _, err := ssh.ParseAuthorizedKey(raw); err == nil {
+			return ssh.FingerprintSHA256(key), nil
+		}
+	}
+	signer, err := ssh.ParsePrivateKey(raw)
+	if err != nil {
+		return "", fmt.Errorf("parse identity %s: %w", identity, err)
+	}
+	return ssh.FingerprintSHA256(signer.PublicKey()), nil
+}
+
+// restrictedAgent only exposes the selected keys of the local agent and asks before
+// every signature if confirm is set. Changing the local agent isn't allowed.
+type restrictedAgent struct {
+	agent.ExtendedAgent
+
+	fingerprints map[string]bool
+	confirm      bool
+}
+
+func (a *restrictedAgent) allowed(key ssh.PublicKey) bool {
+	if len(a.fingerprints) == 0 {
+		return true
+	}
+	return a.fingerprints[ssh.FingerprintSHA256(key)] || a.fingerprints[ssh.FingerprintLegacyMD5(key)] ||
+		a.fingerprints["MD5:"+ssh.FingerprintLegacyMD5(key)]
+}
+
+func (a *restrictedAgent) List() ([]*agent.Key, error) {
+	keys, err := a.ExtendedAgent.List()
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := []*agent.Key{}
+	for _, key := range keys {
+		if a.allowed(key) {
+			allowed = append(allowed, key)
+		}
+	}
+	return allowed, nil
+}
+
+func (a *restrictedAgent) Sign(key ssh.PublicKey, data []byte) (*ssh.Signature, error) {
+	return a.SignWithFlags(key, data, 0)
+}
+
+func (a *restrictedAgent) SignWithFlags(key ssh.PublicKey, data []byte, flags agent.SignatureFlags) (*ssh.Signature, error) {
+	if !a.allowed(key) {
+		return nil, fmt.Errorf("key %s isn't forwarded", ssh.FingerprintSHA256(key))
+	}
+	if a.confirm && !askConfirmation(fmt.Sprintf("Allow the container to use key %s?", ssh.FingerprintSHA256(key))) {
+		return nil, fmt.Errorf("use of key %s was denied", ssh.FingerprintSHA256(key))
+	}
+	return a.ExtendedAgent.SignWithFlags(key, data, flags)
+}
+
+func (a *restrictedAgent) Add(agent.AddedKey) error {
+	return fmt.Errorf("adding keys to the forwarded agent isn't allowed")
+}
+
+func (a *restrictedAgent) Remove(ssh.PublicKey) error {
+	return fmt.Errorf("removing keys from the forwarded agent isn't allowed")
+}
+
+func (a *restrictedAgent) RemoveAll() error {
+	return fmt.Errorf("removing keys from the forwarded agent isn't allowed")
+}
+
+func (a *restrictedAgent) Lock([]byte) error {
+	return fmt.Errorf("locking the forwarded agent isn't allowed")
+}
+
+func (a *restrictedAgent) Unlock([]byte) error {
+	return fmt.Errorf("unlocking the forwarded agent isn't allowed")
+}
+
+func (a *restrictedAgent) Extension(string, []byte) ([]byte, error) {
+	return nil, agent.ErrExtensionUnsupported
+}
+
+// askConfirmation asks through SSH_ASKPASS like ssh-add -c, the terminal belongs to the session
+func askConfirmation(prompt string) bool {
+	askpass := exec.Command(os.Getenv("SSH_ASKPASS"), prompt)
+	askpass.Env = append(os.Environ(), "SSH_ASKPASS_PROMPT=confirm")
+	return askpass.Run() == nil
+}
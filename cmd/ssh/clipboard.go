@@ -0,0 +1,149 @@
+package ssh
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/loft-sh/devpod/pkg/command"
+	"github.com/loft-sh/log"
+)
+
+// osc52Prefix starts a sequence setting the clipboard of the terminal, ESC ] 52 ; selection ; base64
+var osc52Prefix = []byte("\x1b]52;")
+
+// osc52MaxSize is the longest sequence that is held back until its end arrives
+const osc52MaxSize = 1 << 20
+
+// clipboardCommands returns the commands that set the local clipboard from stdin
+func clipboardCommands() [][]string {
+	switch runtime.GOOS {
+	case "darwin":
+		return [][]string{{"pbcopy"}}
+	case "windows":
+		return [][]string{{"clip"}}
+	default:
+		commands := [][]string{}
+		if os.Getenv("WAYLAND_DISPLAY") != "" {
+			commands = append(commands, []string{"wl-copy"})
+		}
+		return append(commands, []string{"xclip", "-selection", "clipboard"}, []string{"xsel", "--clipboard", "--input"})
+	}
+}
+
+// copyToClipboard sets the local clipboard with the first clipboard command found
+func copyToClipboard(data []byte) error {
+	for _, args := range clipboardCommands() {
+		if !command.Exists(args[0]) {
+			continue
+		}
+		copyCmd := exec.Command(args[0], args[1:]...)
+		copyCmd.Stdin = bytes.NewReader(data)
+		out, err := copyCmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s: %w: %s", args[0], err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+	return fmt.Errorf("no clipboard command found, install one of pbcopy, wl-copy, xclip or xsel")
+}
+
+// osc52Writer copies the OSC 52 sequences of the session to the local clipboard, so
+// copying works in terminals without OSC 52 support. Everything else and sequences
+// that can't be copied locally are passed through.
+type osc52Writer struct {
+	out     io.Writer
+	pending []byte
+	log     log.Logger
+}
+
+func (w *osc52Writer) Write(p []byte) (int, error) {
+	data := append(w.pending, p...)
+	w.pending = nil
+	for len(data) > 0 {
+		start := bytes.Index(data, osc52Prefix)
+		if start < 0 {
+			// a prefix may be split across writes
+			keep := partialPrefix(data)
+			if _, err := w.out.Write(data[:len(data)-keep]); err != nil {
+				return 0, err
+			}
+			w.pending = append([]byte{}, data[len(data)-keep:]...)
+			break
+		}
+		if _, err := w.out.Write(data[:start]); err != nil {
+			return 0, err
+		}
+
+		sequence := data[start:]
+		end, terminatorLen := osc52End(sequence)
+		if end < 0 {
+			if len(sequence) > osc52MaxSize {
+				if _, err := w.out.Write(sequence); err != nil {
+					return 0, err
+				}
+			} else {
+				w.pending = append([]byte{}, sequence...)
+			}
+			break
+		}
+
+		if !w.copy(sequence[len(osc52Prefix):end]) {
+			if _, err := w.out.Write(sequence[:end+terminatorLen]); err != nil {
+				return 0, err
+			}
+		}
+		data = sequence[end+terminatorLen:]
+	}
+	return len(p), nil
+}
+
+// copy copies the payload selection;base64 and reports whether it was handled
+func (w *osc52Writer) copy(payload []byte) bool {
+	_, encoded, ok := bytes.Cut(payload, []byte(";"))
+	if !ok || string(encoded) == "?" {
+		// clipboard queries are answered by the local terminal
+		return false
+	}
+	data, err := base64.StdEncoding.DecodeString(string(encoded))
+	if err != nil {
+		return false
+	}
+	err = copyToClipboard(data)
+	if err != nil {
+		w.log.Debugf("Error copying to the clipboard: %v", err)
+		return false
+	}
+	return true
+}
+
+// osc52End returns the index and length of the terminator, BEL or ESC \, -1 if there is none yet
+func osc52End(sequence []byte) (int, int) {
+	for i := len(osc52Prefix); i < len(sequence); i++ {
+		switch sequence[i] {
+		case '\a':
+			return i, 1
+		case '\x1b':
+			if i+1 < len(sequence) && sequence[i+1] == '\\' {
+				return i, 2
+			}
+		}
+	}
+	return -1, 0
+}
+
+// partialPrefix returns the length of the end of data that starts osc52Prefix. A lone
+// ESC isn't held back, it is too common at the end of a write.
+func partialPrefix(data []byte) int {
+	for keep := len(osc52Prefix) - 1; keep >= 2; keep-- {
+		if bytes.HasSuffix(data, osc52Prefix[:keep]) {
+			return keep
+		}
+	}
+	return 0
+}
@@ -0,0 +1,117 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/2017fighting/devssh/cmd/completion"
+	"github.com/2017fighting/devssh/pkg/agent"
+	"github.com/2017fighting/devssh/pkg/agent/tunnelserver"
+	"github.com/2017fighting/devssh/pkg/client"
+	"github.com/alessio/shellescape"
+	provider2 "github.com/loft-sh/devpod/pkg/provider"
+	"github.com/loft-sh/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+type CloneCmd struct {
+	SSHCmd
+
+	Path   string
+	Branch string
+}
+
+func NewCloneCmd() *cobra.Command {
+	cmd := &CloneCmd{}
+	cloneCmd := &cobra.Command{
+		Use:   "clone REPOSITORY [PROFILE]",
+		Short: "Clones a git repository on this machine into a container",
+		Long: `Clones a git repository on this machine into a container.
+
+For clusters without access to the git server. The repository is cloned with the
+local credentials and unpacked in the container as --user, origin stays the
+repository, so later fetches in devssh ssh sessions use the forwarded credentials.
+A local repository is copied with the origin it has.`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(c *cobra.Command, args []string) error {
+			if len(args) == 2 {
+				err := applyProfile(c.Flags(), args[1])
+				if err != nil {
+					return err
+				}
+			}
+			return cmd.Run(context.Background(), args[0], log.Default.ErrorStreamOnly())
+		},
+	}
+	cloneCmd.Flags().StringVar(&cmd.NameSpace, "ns", "", "The k8s namespace of the container")
+	cloneCmd.Flags().StringVar(&cmd.Service, "svc", "", "The k8s service of the container")
+	cloneCmd.Flags().StringVar(&cmd.Container, "container", "", "The container of the pod to connect to, defaults to the first one")
+	cloneCmd.Flags().StringVar(&cmd.User, "user", "root", "The user of the pod to clone as")
+	cloneCmd.Flags().BoolVar(&cmd.Wait, "wait", false, "If the pod is still starting, wait until it is ready instead of failing")
+	cloneCmd.Flags().DurationVar(&cmd.WaitTimeout, "wait-timeout", 5*time.Minute, "How long to wait for a ready pod with --wait")
+	cloneCmd.Flags().StringVar(&cmd.Path, "path", "", "The directory to clone into, relative to the working directory of sessions, defaults to the repository name")
+	cloneCmd.Flags().StringVar(&cmd.Branch, "branch", "", "The branch to check out")
+	completion.RegisterFlagCompletions(cloneCmd)
+	return cloneCmd
+}
+
+func (cmd *CloneCmd) Run(ctx context.Context, repository string, log log.Logger) error {
+	if cmd.NameSpace == "" {
+		return fmt.Errorf("please specify k8s namespace")
+	}
+	if cmd.Service == "" {
+		return fmt.Errorf("please specify k8s service")
+	}
+	if cmd.User == "" {
+		cmd.User = "root"
+	}
+
+	origin := repository
+	if stat, err := os.Stat(repository); err == nil && stat.IsDir() {
+		repository, err = filepath.Abs(repository)
+		if err != nil {
+			return err
+		}
+		out, err := exec.Command("git", "-C", repository, "remote", "get-url", "origin").Output()
+		if err != nil {
+			log.Warnf("%s has no origin, the clone won't have one either", repository)
+		}
+		origin = strings.TrimSpace(string(out))
+	}
+	if cmd.Path == "" {
+		cmd.Path = strings.TrimSuffix(path.Base(strings.TrimRight(filepath.ToSlash(repository), "/")), ".git")
+	}
+
+	workspace := &provider2.Workspace{
+		Source: provider2.WorkspaceSource{
+			GitRepository: repository,
+			GitBranch:     cmd.Branch,
+		},
+	}
+	workspaceClient := client.NewWorkspaceClient(cmd.NameSpace, cmd.Service, log)
+	return cmd.jumpContainer(ctx, workspaceClient, func(ctx context.Context, sshClient *ssh.Client, podUID string, stderr io.Writer) error {
+		return cmd.clone(ctx, sshClient, workspace, origin, log)
+	})
+}
+
+// clone serves StreamGitClone to 'devssh agent git-clone' in the container
+func (cmd *CloneCmd) clone(ctx context.Context, sshClient *ssh.Client, workspace *provider2.Workspace, origin string, log log.Logger) error {
+	command := fmt.Sprintf("'%s' agent git-clone --path %s", agent.ContainerDevPodHelperLocation, shellescape.Quote(cmd.Path))
+	if origin != "" {
+		command += " --repository " + shellescape.Quote(origin)
+	}
+	err := runAgentWithTunnel(ctx, sshClient, command, log, tunnelserver.WithWorkspace(workspace))
+	if err != nil {
+		return errors.Wrap(err, "clone in container")
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package ssh
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detach starts the command in its own session, so it outlives the terminal
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
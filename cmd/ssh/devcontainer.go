@@ -0,0 +1,274 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/2017fighting/devssh/pkg/agent"
+	"github.com/2017fighting/devssh/pkg/agent/tunnelserver"
+	"github.com/2017fighting/devssh/pkg/devcontainer"
+	"github.com/2017fighting/devssh/pkg/kubernetes"
+	"github.com/alessio/shellescape"
+	"github.com/loft-sh/devpod/pkg/devcontainer/config"
+	devssh "github.com/loft-sh/devpod/pkg/ssh"
+	"github.com/loft-sh/devpod/pkg/types"
+	"github.com/loft-sh/log"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// loadDevContainer reads the devcontainer.json of the local repository, or else of the
+// workspace in the pod, and applies what has to be known before connecting: the
+// remoteUser unless --user was given, and the forwardPorts
+func (cmd *SSHCmd) loadDevContainer(ctx context.Context, log log.Logger) error {
+	localFolder, err := localRepository()
+	if err != nil {
+		return err
+	}
+	result, err := devcontainer.Load(localFolder, false)
+	if err != nil {
+		return err
+	}
+
+	// a local repository is cloned to its name below the workspace mount by default
+	containerFolder := path.Join(kubernetes.WorkspaceMountPath, filepath.Base(localFolder))
+	if result == nil {
+		result, err = cmd.podDevContainer(ctx, log)
+		if err != nil {
+			return err
+		} else if result == nil {
+			log.Debugf("No devcontainer.json found")
+			return nil
+		}
+		localFolder = ""
+		if result.SubstitutionContext != nil && result.SubstitutionContext.ContainerWorkspaceFolder != "" {
+			containerFolder = result.SubstitutionContext.ContainerWorkspaceFolder
+		}
+		log.Debugf("Using %s of the workspace in the pod", result.DevContainerConfigWithPath.Path)
+	} else {
+		log.Debugf("Using %s", result.DevContainerConfigWithPath.Config.Origin)
+	}
+
+	localEnv := map[string]string{}
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		localEnv[name] = value
+	}
+	err = devcontainer.Resolve(result, localFolder, containerFolder, localEnv)
+	if err != nil {
+		return err
+	}
+
+	merged := result.MergedConfig
+	if !cmd.userSet && merged.RemoteUser != "" {
+		cmd.User = merged.RemoteUser
+	}
+	for _, port := range merged.ForwardPorts {
+		forward, err := devContainerForward(port)
+		if err != nil {
+			log.Warnf("devcontainer.json: %v", err)
+			continue
+		}
+		cmd.Forwards = appendForward(cmd.Forwards, forward)
+	}
+	cmd.devContainer = result
+	return nil
+}
+
+// podDevContainer runs 'devssh agent devcontainer' in the container, which sends the
+// devcontainer.json of the workspace to the tunnel server. The user of the session
+// depends on it, so it runs through an exec and not through the ssh connection.
+func (cmd *SSHCmd) podDevContainer(ctx context.Context, log log.Logger) (*config.Result, error) {
+	podName, err := kubernetes.FindReadyPod(ctx, cmd.NameSpace, cmd.Service)
+	if err != nil {
+		return nil, err
+	} else if podName == "" {
+		// a workspace that is still starting has no devcontainer.json to read yet
+		log.Warnf("No ready pod of svc %s to read the devcontainer.json from, connecting without it", cmd.Service)
+		return nil, nil
+	}
+
+	stdoutReader, stdoutWriter := io.Pipe()
+	defer stdoutWriter.Close()
+	stdinReader, stdinWriter := io.Pipe()
+	defer stdinWriter.Close()
+
+	cancelCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	resultChan := make(chan *config.Result, 1)
+	go func() {
+		result, err := tunnelserver.New(log).RunWithResult(cancelCtx, stdoutReader, stdinWriter)
+		if err != nil && cancelCtx.Err() == nil {
+			log.Debugf("Error running tunnel server: %v", err)
+		}
+		resultChan <- result
+	}()
+
+	writer := log.ErrorStreamOnly().Writer(logrus.DebugLevel, false)
+	defer writer.Close()
+	command := []string{agent.ContainerDevPodHelperLocation, "agent", "devcontainer"}
+	err = kubernetes.Exec(cancelCtx, cmd.NameSpace, podName, cmd.Container, command, stdinReader, stdoutWriter, writer)
+	cancel()
+	result := <-resultChan
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// localRepository returns the root of the git repository of the working directory,
+// or the working directory outside of one
+func localRepository() (string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for dir := wd; ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir, nil
+		}
+		if filepath.Dir(dir) == dir {
+			return wd, nil
+		}
+	}
+}
+
+// devContainerForward turns a port of forwardPorts, a number or host:port, into a --forward
+func devContainerForward(port string) (string, error) {
+	host, containerPort, ok := strings.Cut(port, ":")
+	if !ok {
+		host, containerPort = "localhost", port
+	}
+	if host == "" || containerPort == "" {
+		return "", fmt.Errorf("invalid forward port %s, expected port or host:port", port)
+	}
+	return fmt.Sprintf("%s:%s:%s", containerPort, host, containerPort), nil
+}
+
+// appendForward adds forward unless a forward on the same local address exists
+func appendForward(forwards []string, forward string) []string {
+	localAddr, _, _ := parseForward(forward)
+	for _, existing := range forwards {
+		if existingAddr, _, err := parseForward(existing); err == nil && existingAddr == localAddr {
+			return forwards
+		}
+	}
+	return append(forwards, forward)
+}
+
+// devContainerEnv returns the containerEnv and remoteEnv of the devcontainer.json
+// without the variables the session sets itself
+func (cmd *SSHCmd) devContainerEnv(sessionEnv map[string]string) map[string]string {
+	env := devcontainer.Env(cmd.devContainer.MergedConfig)
+	for name := range sessionEnv {
+		delete(env, name)
+	}
+	return env
+}
+
+// devContainerCommand runs command in the workspace folder with env exported. The
+// ssh-server only accepts some variables, so they are set by the shell instead.
+func devContainerCommand(env map[string]string, workspaceFolder string, command string) string {
+	parts := []string{}
+	if workspaceFolder != "" {
+		// like the ssh-server with its workdir, a missing folder isn't an error
+		folder := shellescape.Quote(workspaceFolder)
+		parts = append(parts, fmt.Sprintf("if [ -d %s ]; then cd %s; fi", folder, folder))
+	}
+	if len(env) > 0 {
+		names := make([]string, 0, len(env))
+		for name := range env {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		exports := make([]string, 0, len(names))
+		for _, name := range names {
+			exports = append(exports, name+"="+shellescape.Quote(env[name]))
+		}
+		parts = append(parts, "export "+strings.Join(exports, " "))
+	}
+	return strings.Join(append(parts, command), "; ")
+}
+
+// devContainerShell returns the command that starts the login shell of the session
+// with the devcontainer.json applied, or an empty string if there is nothing to apply
+func (cmd *SSHCmd) devContainerShell(sessionEnv map[string]string) string {
+	env := cmd.devContainerEnv(sessionEnv)
+	workspaceFolder := cmd.devContainer.MergedConfig.WorkspaceFolder
+	if len(env) == 0 && workspaceFolder == "" {
+		return ""
+	}
+	return devContainerCommand(env, workspaceFolder, `exec "${SHELL:-/bin/sh}" -l`)
+}
+
+// containerStart identifies a start of the container in its shell, the boot of the
+// node and the start time of its first process
+const containerStart = `$(cat /proc/sys/kernel/random/boot_id 2>/dev/null)-$(sed 's/.*) //' /proc/1/stat | cut -d' ' -f20)`
+
+// runLifecycleHooks runs the postStartCommand once per start of the container, the
+// marker in the home of the user holds the uid of the pod and the containerStart it
+// ran in, and the postAttachCommand every session
+func (cmd *SSHCmd) runLifecycleHooks(ctx context.Context, sshClient *ssh.Client, podUID string, sessionEnv map[string]string, log log.Logger) error {
+	merged := cmd.devContainer.MergedConfig
+	if len(merged.PostStartCommands) > 0 {
+		marker := `"` + podUID + "-" + containerStart + `"`
+		check := fmt.Sprintf("test \"$(cat ~/%s 2>/dev/null)\" = %s", agent.PostStartMarker, marker)
+		if devssh.Run(ctx, sshClient, check, nil, io.Discard, io.Discard) == nil {
+			log.Debugf("The postStartCommand already ran since the container started")
+		} else {
+			err := cmd.runLifecycleHook(ctx, sshClient, "postStartCommand", merged.PostStartCommands, sessionEnv, log)
+			if err != nil {
+				return err
+			}
+			write := fmt.Sprintf("mkdir -p ~/%s && printf %%s %s > ~/%s", path.Dir(agent.PostStartMarker), marker, agent.PostStartMarker)
+			err = devssh.Run(ctx, sshClient, write, nil, io.Discard, io.Discard)
+			if err != nil {
+				return fmt.Errorf("write postStartCommand marker: %w", err)
+			}
+		}
+	}
+
+	return cmd.runLifecycleHook(ctx, sshClient, "postAttachCommand", merged.PostAttachCommands, sessionEnv, log)
+}
+
+// runLifecycleHook runs the commands of the hook one after the other. A string is run
+// in a shell, an array as a single command without one, like the spec defines.
+func (cmd *SSHCmd) runLifecycleHook(ctx context.Context, sshClient *ssh.Client, name string, hooks []types.LifecycleHook, sessionEnv map[string]string, log log.Logger) error {
+	env := cmd.devContainerEnv(sessionEnv)
+	workspaceFolder := cmd.devContainer.MergedConfig.WorkspaceFolder
+	writer := log.ErrorStreamOnly().Writer(logrus.InfoLevel, false)
+	defer writer.Close()
+
+	for _, hook := range hooks {
+		keys := make([]string, 0, len(hook))
+		for key := range hook {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			args := hook[key]
+			if len(args) == 0 {
+				continue
+			}
+			command := args[0]
+			if len(args) > 1 {
+				command = shellescape.QuoteCommand(args)
+			}
+
+			log.Infof("Run %s %s", name, strings.TrimSpace(key+" "+command))
+			err := devssh.Run(ctx, sshClient, devContainerCommand(env, workspaceFolder, command), nil, writer, writer)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
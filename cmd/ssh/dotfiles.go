@@ -0,0 +1,47 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/2017fighting/devssh/pkg/agent"
+	"github.com/alessio/shellescape"
+	"github.com/loft-sh/devpod/pkg/extract"
+	devssh "github.com/loft-sh/devpod/pkg/ssh"
+	"github.com/loft-sh/log"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// installDotfiles installs --dotfiles or --dotfiles-dir once per pod, the marker
+// in the home of the user holds the uid of the pod they were installed in
+func (cmd *SSHCmd) installDotfiles(ctx context.Context, sshClient *ssh.Client, podUID string, log log.Logger) error {
+	marker := shellescape.Quote(podUID)
+	check := fmt.Sprintf("test \"$(cat ~/%s 2>/dev/null)\" = %s", agent.DotfilesMarker, marker)
+	if devssh.Run(ctx, sshClient, check, nil, io.Discard, io.Discard) == nil {
+		log.Debugf("Dotfiles are already installed in this pod")
+		return nil
+	}
+
+	command := fmt.Sprintf("'%s' agent dotfiles --marker %s", agent.ContainerDevPodHelperLocation, marker)
+	if cmd.DotfilesScript != "" {
+		command += " --install-script " + shellescape.Quote(cmd.DotfilesScript)
+	}
+	log.Infof("Install dotfiles")
+	if cmd.Dotfiles != "" {
+		// the clone in the container asks for the local git credentials through the tunnel
+		command += " --repository " + shellescape.Quote(cmd.Dotfiles)
+		return runAgentWithTunnel(ctx, sshClient, command, log)
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		_ = writer.CloseWithError(extract.WriteTar(writer, cmd.DotfilesDir, true))
+	}()
+	defer reader.Close()
+
+	logWriter := log.ErrorStreamOnly().Writer(logrus.InfoLevel, false)
+	defer logWriter.Close()
+	return devssh.Run(ctx, sshClient, command, reader, logWriter, logWriter)
+}
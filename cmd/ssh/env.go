@@ -0,0 +1,68 @@
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"github.com/loft-sh/log"
+	"golang.org/x/crypto/ssh"
+)
+
+// collectEnv returns the variables to send to the container. Later sources win:
+// the env file, then the local variables matching --send-env, then --env.
+func (cmd *SSHCmd) collectEnv() (map[string]string, error) {
+	env := map[string]string{}
+	if cmd.EnvFile != "" {
+		fileEnv, err := godotenv.Read(cmd.EnvFile)
+		if err != nil {
+			return nil, fmt.Errorf("read env file: %w", err)
+		}
+		for name, value := range fileEnv {
+			env[name] = value
+		}
+	}
+
+	for _, pattern := range cmd.SendEnv {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid --send-env pattern %q: %w", pattern, err)
+		}
+		for _, kv := range os.Environ() {
+			name, value, _ := strings.Cut(kv, "=")
+			if ok, _ := path.Match(pattern, name); ok {
+				env[name] = value
+			}
+		}
+	}
+
+	for _, kv := range cmd.Env {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid --env %q, expected KEY=VALUE", kv)
+		}
+		env[name] = value
+	}
+	return env, nil
+}
+
+// sendEnv sends env as env requests, variables the ssh-server rejects are only warned about
+func sendEnv(session *ssh.Session, env map[string]string, log log.Logger) {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	rejected := []string{}
+	for _, name := range names {
+		if err := session.Setenv(name, env[name]); err != nil {
+			rejected = append(rejected, name)
+		}
+	}
+	if len(rejected) > 0 {
+		log.Warnf("The ssh-server rejected %s, allow them with 'devssh ssh-server --accept-env' or DEVSSH_ACCEPT_ENV in the container", strings.Join(rejected, ", "))
+	}
+}
@@ -0,0 +1,44 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	devssh "github.com/loft-sh/devpod/pkg/ssh"
+	"github.com/loft-sh/log"
+	"golang.org/x/crypto/ssh"
+)
+
+// parseForward parses a local forward in the ssh -L format [bind_address:]port:host:hostport
+// and returns the local and remote address
+func parseForward(spec string) (string, string, error) {
+	parts := strings.Split(spec, ":")
+	switch len(parts) {
+	case 3:
+		return net.JoinHostPort("localhost", parts[0]), net.JoinHostPort(parts[1], parts[2]), nil
+	case 4:
+		return net.JoinHostPort(parts[0], parts[1]), net.JoinHostPort(parts[2], parts[3]), nil
+	default:
+		return "", "", fmt.Errorf("invalid forward %s, expected [bind_address:]port:host:hostport", spec)
+	}
+}
+
+func (cmd *SSHCmd) startForwards(ctx context.Context, sshClient *ssh.Client, log log.Logger) {
+	for _, spec := range cmd.Forwards {
+		localAddr, remoteAddr, err := parseForward(spec)
+		if err != nil {
+			log.Warnf("%v", err)
+			continue
+		}
+
+		go func() {
+			log.Infof("Forward %s to %s in the container", localAddr, remoteAddr)
+			err := devssh.PortForward(ctx, sshClient, "tcp", localAddr, "tcp", remoteAddr, 0, log)
+			if err != nil && ctx.Err() == nil {
+				log.Warnf("Error forwarding %s: %v", localAddr, err)
+			}
+		}()
+	}
+}
@@ -0,0 +1,94 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/2017fighting/devssh/pkg/agent"
+	"github.com/alessio/shellescape"
+	devssh "github.com/loft-sh/devpod/pkg/ssh"
+	"github.com/loft-sh/log"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// setupGPGAgent forwards the extra socket of the local gpg-agent to the agent socket
+// of the user in the container and imports the local public keys. Signing is
+// configured for git in env, so the git config of the container isn't changed and
+// concurrent sessions don't interfere.
+func (cmd *SSHCmd) setupGPGAgent(ctx context.Context, sshClient *ssh.Client, env map[string]string, log log.Logger) error {
+	extraSocket, err := exec.Command("gpgconf", "--list-dir", "agent-extra-socket").Output()
+	if err != nil {
+		return fmt.Errorf("find local gpg-agent socket: %w", err)
+	}
+	// the tunnel has no rpc for the public keys, so they are exported here and
+	// passed to the container with the setup command
+	setup := &agent.GPGSetup{}
+	setup.PublicKeys, err = exec.Command("gpg", "--armor", "--export").Output()
+	if err != nil {
+		return fmt.Errorf("export local public keys: %w", err)
+	}
+	setup.OwnerTrust, err = exec.Command("gpg", "--export-ownertrust").Output()
+	if err != nil {
+		return fmt.Errorf("export local ownertrust: %w", err)
+	}
+	signingKey, _ := exec.Command("git", "config", "user.signingKey").Output()
+
+	writer := log.ErrorStreamOnly().Writer(logrus.DebugLevel, false)
+	defer writer.Close()
+
+	// the agent of the container would hold the socket, so it is stopped first
+	remoteSocket := &bytes.Buffer{}
+	err = devssh.Run(ctx, sshClient, "mkdir -p -m 700 ~/.gnupg && gpgconf --kill gpg-agent; gpgconf --create-socketdir 2>/dev/null; gpgconf --list-dir agent-socket", nil, remoteSocket, writer)
+	if err != nil {
+		return fmt.Errorf("find gpg-agent socket in the container, is gnupg installed? %w", err)
+	}
+	socketPath := strings.TrimSpace(remoteSocket.String())
+	if socketPath == "" {
+		return fmt.Errorf("find gpg-agent socket in the container")
+	}
+
+	log.Debugf("Forward gpg-agent %s to %s", strings.TrimSpace(string(extraSocket)), socketPath)
+	go func() {
+		err := devssh.ReversePortForward(ctx, sshClient, "unix", socketPath, "unix", strings.TrimSpace(string(extraSocket)), 0, log)
+		if err != nil {
+			log.Warnf("Error forwarding gpg-agent: %v", err)
+		}
+	}()
+
+	rawSetup, err := json.Marshal(setup)
+	if err != nil {
+		return err
+	}
+	addGitConfigEnv(env, "commit.gpgsign", "true")
+	if key := strings.TrimSpace(string(signingKey)); key != "" {
+		addGitConfigEnv(env, "user.signingKey", key)
+	}
+
+	command := fmt.Sprintf("'%s' agent setup-gpg --socket %s", agent.ContainerDevPodHelperLocation, shellescape.Quote(socketPath))
+	stdin := bytes.NewReader(append(rawSetup, '\n'))
+	go func() {
+		writer := log.ErrorStreamOnly().Writer(logrus.DebugLevel, false)
+		defer writer.Close()
+
+		err := devssh.Run(ctx, sshClient, command, stdin, writer, writer)
+		if err != nil && ctx.Err() == nil {
+			log.Warnf("Error setting up gpg in the container: %v", err)
+		}
+	}()
+	return nil
+}
+
+// addGitConfigEnv adds key to the git config in env through GIT_CONFIG_COUNT,
+// after the entries env already has
+func addGitConfigEnv(env map[string]string, key string, value string) {
+	count, _ := strconv.Atoi(env["GIT_CONFIG_COUNT"])
+	env[fmt.Sprintf("GIT_CONFIG_KEY_%d", count)] = key
+	env[fmt.Sprintf("GIT_CONFIG_VALUE_%d", count)] = value
+	env["GIT_CONFIG_COUNT"] = strconv.Itoa(count + 1)
+}
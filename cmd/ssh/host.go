@@ -0,0 +1,86 @@
+package ssh
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/2017fighting/devssh/pkg/agent"
+	"github.com/2017fighting/devssh/pkg/ssh/server"
+	"github.com/loft-sh/log"
+	"github.com/skratchdot/open-golang/open"
+	"golang.org/x/crypto/ssh"
+)
+
+// startHostForward lets 'devssh agent open' and 'devssh agent copy' in the session
+// open urls in the local browser and copy to the local clipboard
+func (cmd *SSHCmd) startHostForward(sshClient *ssh.Client, session *ssh.Session, log log.Logger) error {
+	channels := sshClient.HandleChannelOpen(server.HostChannel)
+	if channels == nil {
+		return fmt.Errorf("host channels are already handled")
+	}
+	go func() {
+		for newChannel := range channels {
+			go cmd.handleHostChannel(newChannel, log)
+		}
+	}()
+
+	ok, err := session.SendRequest(server.HostForwardRequest, true, nil)
+	if err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("the container doesn't support browser and clipboard forwarding")
+	}
+	return nil
+}
+
+func (cmd *SSHCmd) handleHostChannel(newChannel ssh.NewChannel, log log.Logger) {
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		log.Debugf("Error accepting host channel: %v", err)
+		return
+	}
+	defer channel.Close()
+	go ssh.DiscardRequests(requests)
+
+	line, err := bufio.NewReader(channel).ReadBytes('\n')
+	if err != nil {
+		log.Debugf("Error reading host request: %v", err)
+		return
+	}
+	request := &agent.HostRequest{}
+	response := &agent.HostResponse{}
+	err = json.Unmarshal(line, request)
+	if err == nil {
+		err = cmd.handleHostRequest(request, log)
+	}
+	if err != nil {
+		response.Error = err.Error()
+	}
+	_ = json.NewEncoder(channel).Encode(response)
+}
+
+func (cmd *SSHCmd) handleHostRequest(request *agent.HostRequest, log log.Logger) error {
+	switch request.Action {
+	case agent.HostActionOpen:
+		if !cmd.ForwardBrowser {
+			return fmt.Errorf("opening urls isn't forwarded, connect with --forward-browser")
+		}
+		// never let the container start local programs through file or custom urls
+		target, err := url.Parse(request.URL)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") {
+			return fmt.Errorf("only http and https urls can be opened")
+		}
+		log.Infof("Opening %s", request.URL)
+		return open.Start(request.URL)
+	case agent.HostActionCopy:
+		if !cmd.Clipboard {
+			return fmt.Errorf("the clipboard isn't forwarded, connect with --clipboard")
+		}
+		log.Debugf("Copying %d bytes to the clipboard", len(request.Data))
+		return copyToClipboard(request.Data)
+	default:
+		return fmt.Errorf("unknown action %s", request.Action)
+	}
+}
@@ -0,0 +1,60 @@
+package ssh
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+
+	"github.com/2017fighting/devssh/pkg/agent"
+	"github.com/2017fighting/devssh/pkg/kubernetes"
+	devssh "github.com/loft-sh/devpod/pkg/ssh"
+	"github.com/loft-sh/log"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// forwardKubeConfig writes the kubeconfig of the current context to a file of the
+// session in the container until the session ends and points KUBECONFIG in env at it.
+// The tunnel has no rpc for the kubeconfig, so it is passed to 'devssh agent kubeconfig'
+// on stdin, which answers with the path of the file.
+func (cmd *SSHCmd) forwardKubeConfig(ctx context.Context, sshClient *ssh.Client, env map[string]string, log log.Logger) error {
+	kubeConfig, err := kubernetes.MinifiedConfig(log)
+	if err != nil {
+		return err
+	}
+
+	stdinReader, stdinWriter := io.Pipe()
+	go func() {
+		_, _ = stdinWriter.Write([]byte(base64.StdEncoding.EncodeToString(kubeConfig) + "\n"))
+		// closing stdin removes the kubeconfig again
+		<-ctx.Done()
+		_ = stdinWriter.Close()
+	}()
+
+	stdoutReader, stdoutWriter := io.Pipe()
+	go func() {
+		writer := log.ErrorStreamOnly().Writer(logrus.DebugLevel, false)
+		defer writer.Close()
+
+		command := fmt.Sprintf("'%s' agent kubeconfig", agent.ContainerDevPodHelperLocation)
+		err := devssh.Run(ctx, sshClient, command, stdinReader, stdoutWriter, writer)
+		if err != nil && ctx.Err() == nil {
+			log.Warnf("Error forwarding kubeconfig: %v", err)
+		}
+		if err == nil {
+			err = fmt.Errorf("agent kubeconfig exited")
+		}
+		_ = stdoutWriter.CloseWithError(err)
+	}()
+
+	path, err := readLine(stdoutReader)
+	if err != nil {
+		return err
+	}
+	go func() {
+		_, _ = io.Copy(io.Discard, stdoutReader)
+	}()
+	env["KUBECONFIG"] = path
+	return nil
+}
@@ -0,0 +1,331 @@
+package ssh
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/2017fighting/devssh/pkg/client"
+	"github.com/2017fighting/devssh/pkg/ssh/server"
+	"github.com/gofrs/flock"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+type MasterCmd struct {
+	SSHCmd
+}
+
+// NewMasterCmd returns the background process started by devssh ssh --multiplex
+func NewMasterCmd() *cobra.Command {
+	cmd := &MasterCmd{}
+	masterCmd := &cobra.Command{
+		Use:    "ssh-master",
+		Short:  "Holds a connection to a container and shares it through a unix socket",
+		Args:   cobra.NoArgs,
+		Hidden: true,
+		RunE: func(_ *cobra.Command, args []string) error {
+			return cmd.Run(context.Background(), log.Default.ErrorStreamOnly())
+		},
+	}
+	masterCmd.Flags().StringVar(&cmd.NameSpace, "ns", "", "The k8s namespace of the container")
+	masterCmd.Flags().StringVar(&cmd.Service, "svc", "", "The k8s service of the container")
+	masterCmd.Flags().StringVar(&cmd.Container, "container", "", "The container of the pod to connect to")
+	masterCmd.Flags().StringVar(&cmd.DebugImage, "debug-image", "", "Attach an ephemeral debug container with this image")
+	masterCmd.Flags().StringVar(&cmd.User, "user", "root", "The user of the pod to use")
+	masterCmd.Flags().BoolVar(&cmd.Wait, "wait", false, "Wait until the pod is ready")
+	masterCmd.Flags().DurationVar(&cmd.WaitTimeout, "wait-timeout", 5*time.Minute, "How long to wait for a ready pod with --wait")
+	masterCmd.Flags().DurationVar(&cmd.SSHCmd.ControlPersist, "control-persist", 10*time.Minute, "How long to keep the connection without sessions")
+	return masterCmd
+}
+
+func (cmd *MasterCmd) Run(ctx context.Context, log log.Logger) error {
+	socketPath, err := cmd.controlPath()
+	if err != nil {
+		return err
+	}
+
+	// only one master per workspace, the others leave the socket to it
+	lock := flock.New(socketPath + ".lock")
+	locked, err := lock.TryLock()
+	if err != nil {
+		return err
+	} else if !locked {
+		log.Debugf("Another master is running for %s", socketPath)
+		return nil
+	}
+	defer lock.Unlock()
+
+	workspaceClient := client.NewWorkspaceClient(cmd.NameSpace, cmd.Service, log)
+	return cmd.jumpContainer(ctx, workspaceClient, func(ctx context.Context, sshClient *ssh.Client, podUID string, stderr io.Writer) error {
+		return cmd.serve(ctx, sshClient, socketPath, podUID, log)
+	})
+}
+
+// serve shares sshClient on the socket until it was idle for ControlPersist
+func (cmd *MasterCmd) serve(ctx context.Context, sshClient *ssh.Client, socketPath string, podUID string, log log.Logger) error {
+	_ = os.Remove(socketPath)
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("listen on %s: %w", socketPath, err)
+	}
+	defer os.Remove(socketPath)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+
+	// the clients talk ssh to the master over the socket only the user can reach,
+	// the key is new for every master and no client authenticates
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	hostKey, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return err
+	}
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(hostKey)
+	router := newRouter(sshClient, log)
+
+	var (
+		m      sync.Mutex
+		active int
+	)
+	idle := time.AfterFunc(cmd.ControlPersist, func() {
+		m.Lock()
+		defer m.Unlock()
+		if active == 0 {
+			log.Infof("No sessions for %s, closing the connection", cmd.ControlPersist)
+			cancel()
+		}
+	})
+	defer idle.Stop()
+
+	log.Infof("Sharing the connection on %s", socketPath)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		m.Lock()
+		active++
+		idle.Stop()
+		m.Unlock()
+		go func() {
+			defer func() {
+				m.Lock()
+				defer m.Unlock()
+				active--
+				if active == 0 {
+					idle.Reset(cmd.ControlPersist)
+				}
+			}()
+
+			err := cmd.serveConn(sshClient, conn, podUID, config, router)
+			if err != nil && ctx.Err() == nil {
+				log.Debugf("Error serving session: %v", err)
+			}
+		}()
+	}
+}
+
+// routedRequests are the session requests after which the container opens channels of
+// a type to the client, the master routes them to the client that asked last
+var routedRequests = map[string]string{
+	"x11-req":                    "x11",
+	"auth-agent-req@openssh.com": "auth-agent@openssh.com",
+	server.HostForwardRequest:    server.HostChannel,
+}
+
+// router hands the channels the container opens to the clients of the master
+type router struct {
+	m       sync.Mutex
+	targets map[string][]ssh.Conn
+}
+
+func newRouter(sshClient *ssh.Client, log log.Logger) *router {
+	r := &router{targets: map[string][]ssh.Conn{}}
+	for _, channelType := range routedRequests {
+		channels := sshClient.HandleChannelOpen(channelType)
+		if channels == nil {
+			continue
+		}
+		go func() {
+			for newChannel := range channels {
+				go func() {
+					err := r.route(newChannel)
+					if err != nil {
+						log.Debugf("Error routing %s channel: %v", newChannel.ChannelType(), err)
+					}
+				}()
+			}
+		}()
+	}
+	return r
+}
+
+func (r *router) add(channelType string, conn ssh.Conn) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.targets[channelType] = append(r.targets[channelType], conn)
+}
+
+func (r *router) remove(conn ssh.Conn) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	for channelType, conns := range r.targets {
+		kept := []ssh.Conn{}
+		for _, target := range conns {
+			if target != conn {
+				kept = append(kept, target)
+			}
+		}
+		r.targets[channelType] = kept
+	}
+}
+
+func (r *router) route(newChannel ssh.NewChannel) error {
+	r.m.Lock()
+	conns := r.targets[newChannel.ChannelType()]
+	var conn ssh.Conn
+	if len(conns) > 0 {
+		conn = conns[len(conns)-1]
+	}
+	r.m.Unlock()
+	if conn == nil {
+		return newChannel.Reject(ssh.Prohibited, "no session asked for it")
+	}
+	return openProxy(conn, newChannel, nil)
+}
+
+// serveConn runs an ssh server for conn that opens every channel of the client on the
+// shared connection, so the client can use every feature without a connection of its own
+func (cmd *MasterCmd) serveConn(sshClient *ssh.Client, conn net.Conn, podUID string, config *ssh.ServerConfig, router *router) error {
+	defer conn.Close()
+
+	// the client doesn't look up the pod, so it gets told the uid first
+	_, err := fmt.Fprintf(conn, "%s\n", podUID)
+	if err != nil {
+		return err
+	}
+
+	serverConn, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return err
+	}
+	defer serverConn.Close()
+	defer router.remove(serverConn)
+
+	go func() {
+		for request := range requests {
+			// remote forwards would open channels that can't be told apart between clients
+			if request.Type == "tcpip-forward" || request.Type == "cancel-tcpip-forward" {
+				_ = request.Reply(false, nil)
+				continue
+			}
+			ok, payload, err := sshClient.SendRequest(request.Type, request.WantReply, request.Payload)
+			if err != nil {
+				ok = false
+			}
+			if request.WantReply {
+				_ = request.Reply(ok, payload)
+			}
+		}
+	}()
+
+	for newChannel := range channels {
+		go func() {
+			err := openProxy(sshClient, newChannel, func(request *ssh.Request) {
+				if channelType, ok := routedRequests[request.Type]; ok {
+					router.add(channelType, serverConn)
+				}
+			})
+			if err != nil {
+				log.Default.Debugf("Error proxying %s channel: %v", newChannel.ChannelType(), err)
+			}
+		}()
+	}
+	return serverConn.Wait()
+}
+
+// openProxy opens newChannel on conn and copies between both until they are closed,
+// onRequest sees the requests of the side that opened the channel
+func openProxy(conn ssh.Conn, newChannel ssh.NewChannel, onRequest func(request *ssh.Request)) error {
+	target, targetRequests, err := conn.OpenChannel(newChannel.ChannelType(), newChannel.ExtraData())
+	if err != nil {
+		var openErr *ssh.OpenChannelError
+		if errors.As(err, &openErr) {
+			return newChannel.Reject(openErr.Reason, openErr.Message)
+		}
+		return newChannel.Reject(ssh.ConnectionFailed, err.Error())
+	}
+	source, sourceRequests, err := newChannel.Accept()
+	if err != nil {
+		_ = target.Close()
+		return err
+	}
+
+	closed := make(chan struct{}, 2)
+	go func() {
+		forwardRequests(sourceRequests, target, onRequest)
+		closed <- struct{}{}
+	}()
+	go func() {
+		forwardRequests(targetRequests, source, nil)
+		closed <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(target, source)
+		_ = target.CloseWrite()
+	}()
+
+	var output sync.WaitGroup
+	output.Add(2)
+	go func() {
+		defer output.Done()
+		_, _ = io.Copy(source, target)
+	}()
+	go func() {
+		defer output.Done()
+		_, _ = io.Copy(source.Stderr(), target.Stderr())
+	}()
+	output.Wait()
+	_ = source.CloseWrite()
+
+	// the exit status is a request sent before the channel is closed, so both are
+	// closed once one side closed its requests
+	<-closed
+	_ = target.Close()
+	_ = source.Close()
+	<-closed
+	return nil
+}
+
+func forwardRequests(requests <-chan *ssh.Request, channel ssh.Channel, onRequest func(request *ssh.Request)) {
+	for request := range requests {
+		if onRequest != nil {
+			onRequest(request)
+		}
+		ok, err := channel.SendRequest(request.Type, request.WantReply, request.Payload)
+		if request.WantReply {
+			_ = request.Reply(ok && err == nil, nil)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/2017fighting/devssh/pkg/agent"
+	"github.com/2017fighting/devssh/pkg/agent/tunnelserver"
+	"github.com/alessio/shellescape"
+	"github.com/loft-sh/devpod/pkg/devcontainer/config"
+	"github.com/loft-sh/log"
+	"golang.org/x/crypto/ssh"
+)
+
+// parseMount parses a --mount of the format local_dir:remote_dir
+func parseMount(spec string) (*config.Mount, error) {
+	source, target, err := parseDirs(spec)
+	if err != nil {
+		return nil, err
+	}
+	return &config.Mount{
+		Type:   "bind",
+		Source: source,
+		Target: target,
+	}, nil
+}
+
+// parseDirs parses local_dir:remote_dir, the last colon separates them so windows
+// drive letters work. The local directory has to exist.
+func parseDirs(spec string) (string, string, error) {
+	index := strings.LastIndex(spec, ":")
+	if index <= 0 || index == len(spec)-1 {
+		return "", "", fmt.Errorf("invalid %s, expected local_dir:remote_dir", spec)
+	}
+	source, err := filepath.Abs(spec[:index])
+	if err != nil {
+		return "", "", err
+	}
+	stat, err := os.Stat(source)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", spec, err)
+	} else if !stat.IsDir() {
+		return "", "", fmt.Errorf("%s: %s is not a directory", spec, source)
+	}
+	target := spec[index+1:]
+	if !path.IsAbs(target) {
+		return "", "", fmt.Errorf("%s: the remote directory has to be absolute", spec)
+	}
+	return source, path.Clean(target), nil
+}
+
+// copyMounts copies the local directories of --mount into the container through
+// 'devssh agent mount', which unpacks them as --user
+func (cmd *SSHCmd) copyMounts(ctx context.Context, sshClient *ssh.Client, log log.Logger) error {
+	mounts := []*config.Mount{}
+	for _, spec := range cmd.Mounts {
+		mount, err := parseMount(spec)
+		if err != nil {
+			return err
+		}
+		mounts = append(mounts, mount)
+	}
+
+	for _, mount := range mounts {
+		command := fmt.Sprintf("'%s' agent mount --mount %s", agent.ContainerDevPodHelperLocation, shellescape.Quote(mount.String()))
+		err := runAgentWithTunnel(ctx, sshClient, command, log, tunnelserver.WithMounts(mounts))
+		if err != nil {
+			return fmt.Errorf("copy %s: %w", mount.Source, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/2017fighting/devssh/pkg/kubernetes"
+	"github.com/2017fighting/devssh/pkg/provider"
+	devssh "github.com/loft-sh/devpod/pkg/ssh"
+	"github.com/loft-sh/log"
+	"golang.org/x/crypto/ssh"
+)
+
+// masterStartTimeout is how long to wait for a new master, on top of --wait-timeout
+const masterStartTimeout = time.Minute
+
+// controlPath returns the socket of the master for this workspace, container and
+// user. The name is hashed, as unix socket paths are limited to about 100 bytes.
+func (cmd *SSHCmd) controlPath() (string, error) {
+	kubeContext, err := kubernetes.CurrentContext()
+	if err != nil {
+		return "", err
+	}
+	controlDir, err := provider.GetControlDir()
+	if err != nil {
+		return "", err
+	}
+	err = os.MkdirAll(controlDir, 0o700)
+	if err != nil {
+		return "", err
+	}
+
+	key := strings.Join([]string{kubeContext, cmd.NameSpace, cmd.Service, cmd.Container, cmd.DebugImage, cmd.User}, "\x00")
+	hash := sha256.Sum256([]byte(key))
+	return filepath.Join(controlDir, hex.EncodeToString(hash[:8])+".sock"), nil
+}
+
+// dialMaster connects through the master of the workspace and starts one if there is none
+func (cmd *SSHCmd) dialMaster(ctx context.Context, log log.Logger) (*ssh.Client, string, error) {
+	socketPath, err := cmd.controlPath()
+	if err != nil {
+		return nil, "", err
+	}
+
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		log.Debugf("No connection master running, start one")
+		conn, err = cmd.startMaster(ctx, socketPath, log)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	podUID, err := readLine(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, "", fmt.Errorf("read from connection master: %w", err)
+	}
+	sshClient, err := devssh.StdioClientWithUser(conn, conn, cmd.User, false)
+	if err != nil {
+		_ = conn.Close()
+		return nil, "", fmt.Errorf("connect through connection master: %w", err)
+	}
+	log.Debugf("Connected through master %s", socketPath)
+	return sshClient, podUID, nil
+}
+
+// startMaster runs devssh ssh-master in the background and waits for its socket
+func (cmd *SSHCmd) startMaster(ctx context.Context, socketPath string, log log.Logger) (net.Conn, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	kubeContext, err := kubernetes.CurrentContext()
+	if err != nil {
+		return nil, err
+	}
+
+	logPath := strings.TrimSuffix(socketPath, ".sock") + ".log"
+	// appended, a master that loses the race must not truncate the log of the running one
+	logFile, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	defer logFile.Close()
+
+	args := []string{
+		"ssh-master",
+		"--context", kubeContext,
+		"--ns", cmd.NameSpace,
+		"--svc", cmd.Service,
+		"--container", cmd.Container,
+		"--debug-image", cmd.DebugImage,
+		"--user", cmd.User,
+		"--wait=" + strconv.FormatBool(cmd.Wait),
+		"--wait-timeout", cmd.WaitTimeout.String(),
+		"--control-persist", cmd.ControlPersist.String(),
+	}
+	master := exec.Command(executable, args...)
+	master.Stdout = logFile
+	master.Stderr = logFile
+	detach(master)
+	err = master.Start()
+	if err != nil {
+		return nil, fmt.Errorf("start connection master: %w", err)
+	}
+	exited := make(chan error, 1)
+	go func() {
+		exited <- master.Wait()
+	}()
+
+	timeout := masterStartTimeout
+	if cmd.Wait {
+		timeout += cmd.WaitTimeout
+	}
+	deadline := time.After(timeout)
+	for {
+		conn, err := net.Dial("unix", socketPath)
+		if err == nil {
+			return conn, nil
+		}
+
+		select {
+		case err := <-exited:
+			// a master that lost the race against another one exits without error
+			if err != nil {
+				return nil, fmt.Errorf("connection master exited: %s", lastLines(logPath, 5))
+			}
+			exited = nil
+		case <-deadline:
+			return nil, fmt.Errorf("connection master didn't start within %s, see %s", timeout, logPath)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+// readLine reads up to the next newline without buffering what follows it
+func readLine(reader io.Reader) (string, error) {
+	line := []byte{}
+	b := make([]byte, 1)
+	for {
+		_, err := reader.Read(b)
+		if err != nil {
+			return "", err
+		}
+		if b[0] == '\n' {
+			return string(line), nil
+		}
+		line = append(line, b[0])
+	}
+}
+
+func lastLines(path string, n int) string {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err.Error()
+	}
+	lines := bytes.Split(bytes.TrimSpace(raw), []byte("\n"))
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return string(bytes.Join(lines, []byte("\n")))
+}
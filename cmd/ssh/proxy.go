@@ -0,0 +1,312 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/2017fighting/devssh/cmd/completion"
+	"github.com/2017fighting/devssh/pkg/client"
+	"github.com/2017fighting/devssh/pkg/profile"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// proxyKeepAlive is how often the tunnel is checked, a broken one is reconnected
+	proxyKeepAlive = 30 * time.Second
+	// proxyMaxBackoff is the longest wait between reconnects
+	proxyMaxBackoff = 30 * time.Second
+)
+
+type ProxyCmd struct {
+	SSHCmd
+
+	Services []string
+	Address  string
+}
+
+// proxyService is a local listener for a service in the cluster
+type proxyService struct {
+	local  string
+	remote string
+}
+
+func NewProxyCmd() *cobra.Command {
+	cmd := &ProxyCmd{}
+	proxyCmd := &cobra.Command{
+		Use:   "proxy [PROFILE]",
+		Short: "Exposes services of the cluster on local ports through a container",
+		Long: `Exposes services of the cluster on local ports through a container.
+
+The service names are resolved in the pod, so names like db.ns or db.ns.svc.cluster.local
+work. The local ports stay open and the tunnel is reconnected when it breaks.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			if len(args) == 1 {
+				err := applyProfile(c.Flags(), args[0])
+				if err != nil {
+					return err
+				}
+			}
+			return cmd.Run(context.Background(), log.Default.ErrorStreamOnly())
+		},
+		ValidArgsFunction: func(_ *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+			if len(args) > 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			config, err := profile.Load()
+			if err != nil {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return config.Names(), cobra.ShellCompDirectiveNoFileComp
+		},
+	}
+	proxyCmd.Flags().StringVar(&cmd.NameSpace, "ns", "", "The k8s namespace of the container")
+	proxyCmd.Flags().StringVar(&cmd.Service, "svc", "", "The k8s service of the container to proxy through")
+	proxyCmd.Flags().StringVar(&cmd.Container, "container", "", "The container of the pod to connect to, defaults to the first one")
+	proxyCmd.Flags().StringVar(&cmd.User, "user", "root", "The user of the pod to use")
+	proxyCmd.Flags().BoolVar(&cmd.Wait, "wait", false, "If the pod is still starting, wait until it is ready instead of failing")
+	proxyCmd.Flags().DurationVar(&cmd.WaitTimeout, "wait-timeout", 5*time.Minute, "How long to wait for a ready pod with --wait")
+	proxyCmd.Flags().BoolVar(&cmd.Multiplex, "multiplex", false, "Share one connection to the container between invocations through a background master process")
+	proxyCmd.Flags().DurationVar(&cmd.ControlPersist, "control-persist", 10*time.Minute, "How long the master process of --multiplex keeps the connection without sessions")
+	proxyCmd.Flags().StringArrayVar(&cmd.Services, "service", []string{}, "Expose a service of the cluster, in the format [local_port:]host:port, e.g. db.ns:5432")
+	proxyCmd.Flags().StringVar(&cmd.Address, "address", "localhost", "The local address to listen on")
+	completion.RegisterFlagCompletions(proxyCmd)
+	return proxyCmd
+}
+
+// parseProxyService parses a service in the format [local_port:]host:port
+func parseProxyService(address string, spec string) (*proxyService, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) == 2 {
+		parts = append([]string{parts[1]}, parts...)
+	}
+	if len(parts) != 3 || parts[1] == "" {
+		return nil, fmt.Errorf("invalid service %s, expected [local_port:]host:port", spec)
+	}
+	for _, port := range []string{parts[0], parts[2]} {
+		if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			return nil, fmt.Errorf("invalid service %s, port %s is not a number", spec, port)
+		}
+	}
+	return &proxyService{
+		local:  net.JoinHostPort(address, parts[0]),
+		remote: net.JoinHostPort(parts[1], parts[2]),
+	}, nil
+}
+
+func (cmd *ProxyCmd) Run(ctx context.Context, log log.Logger) error {
+	if cmd.NameSpace == "" {
+		return fmt.Errorf("please specify k8s namespace")
+	}
+	if cmd.Service == "" {
+		return fmt.Errorf("please specify k8s service")
+	}
+	if len(cmd.Services) == 0 {
+		return fmt.Errorf("please specify at least one --service")
+	}
+	if cmd.User == "" {
+		cmd.User = "root"
+	}
+
+	services := []*proxyService{}
+	for _, spec := range cmd.Services {
+		service, err := parseProxyService(cmd.Address, spec)
+		if err != nil {
+			return err
+		}
+		services = append(services, service)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// the listeners are opened once and outlive the tunnel
+	tunnel := &proxyTunnel{ready: make(chan struct{})}
+	errChan := make(chan error, len(services)+1)
+	for _, service := range services {
+		listener, err := net.Listen("tcp", service.local)
+		if err != nil {
+			return fmt.Errorf("listen on %s: %w", service.local, err)
+		}
+		go func() {
+			<-ctx.Done()
+			_ = listener.Close()
+		}()
+		log.Infof("Proxy %s to %s", service.local, service.remote)
+		go func() {
+			errChan <- tunnel.serve(ctx, listener, service.remote, log)
+		}()
+	}
+
+	go func() {
+		errChan <- cmd.connectLoop(ctx, tunnel, log)
+	}()
+	return <-errChan
+}
+
+// connectLoop keeps the tunnel connected until ctx is done
+func (cmd *ProxyCmd) connectLoop(ctx context.Context, tunnel *proxyTunnel, log log.Logger) error {
+	workspaceClient := client.NewWorkspaceClient(cmd.NameSpace, cmd.Service, log)
+	backoff := time.Second
+	for {
+		connected := atomic.Bool{}
+		run := func(ctx context.Context, sshClient *ssh.Client, podUID string, stderr io.Writer) error {
+			connected.Store(true)
+			tunnel.set(sshClient)
+			defer tunnel.unset(sshClient)
+			log.Donef("Connected to %s/%s, proxying", cmd.NameSpace, cmd.Service)
+			return keepAlive(ctx, sshClient)
+		}
+
+		var err error
+		if cmd.Multiplex {
+			var sshClient *ssh.Client
+			sshClient, _, err = cmd.dialMaster(ctx, log)
+			if err == nil {
+				err = run(ctx, sshClient, "", nil)
+				_ = sshClient.Close()
+			}
+		} else {
+			err = cmd.jumpContainer(ctx, workspaceClient, run)
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if connected.Load() {
+			backoff = time.Second
+		}
+		log.Warnf("Tunnel closed: %v, reconnecting in %s", err, backoff)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, proxyMaxBackoff)
+	}
+}
+
+// keepAlive returns when the connection of sshClient is closed or broken
+func keepAlive(ctx context.Context, sshClient *ssh.Client) error {
+	closed := make(chan error, 1)
+	go func() {
+		closed <- sshClient.Wait()
+	}()
+
+	ticker := time.NewTicker(proxyKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-closed:
+			if err == nil {
+				err = fmt.Errorf("connection closed")
+			}
+			return err
+		case <-ticker.C:
+			_, _, err := sshClient.SendRequest("keepalive@openssh.com", true, nil)
+			if err != nil {
+				_ = sshClient.Close()
+				return fmt.Errorf("keepalive: %w", err)
+			}
+		}
+	}
+}
+
+// proxyTunnel is the current connection, connections wait for it while it is reconnected
+type proxyTunnel struct {
+	m         sync.Mutex
+	sshClient *ssh.Client
+	ready     chan struct{}
+}
+
+func (t *proxyTunnel) set(sshClient *ssh.Client) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	if t.sshClient == nil {
+		close(t.ready)
+	}
+	t.sshClient = sshClient
+}
+
+// unset removes sshClient unless it was already replaced by a new connection
+func (t *proxyTunnel) unset(sshClient *ssh.Client) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	if t.sshClient == sshClient {
+		t.sshClient = nil
+		t.ready = make(chan struct{})
+	}
+}
+
+func (t *proxyTunnel) get(ctx context.Context) (*ssh.Client, error) {
+	t.m.Lock()
+	sshClient, ready := t.sshClient, t.ready
+	t.m.Unlock()
+	if sshClient != nil {
+		return sshClient, nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-ready:
+		return t.get(ctx)
+	}
+}
+
+func (t *proxyTunnel) serve(ctx context.Context, listener net.Listener, remote string, log log.Logger) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		go func() {
+			defer conn.Close()
+			err := t.proxy(ctx, conn, remote)
+			if err != nil && ctx.Err() == nil {
+				log.Warnf("Error proxying to %s: %v", remote, err)
+			}
+		}()
+	}
+}
+
+func (t *proxyTunnel) proxy(ctx context.Context, conn net.Conn, remote string) error {
+	sshClient, err := t.get(ctx)
+	if err != nil {
+		return err
+	}
+	remoteConn, err := sshClient.Dial("tcp", remote)
+	if err != nil {
+		return err
+	}
+	defer remoteConn.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(remoteConn, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(conn, remoteConn)
+		done <- struct{}{}
+	}()
+	<-done
+	return nil
+}
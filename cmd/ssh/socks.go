@@ -0,0 +1,199 @@
+package ssh
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/loft-sh/log"
+	"golang.org/x/crypto/ssh"
+)
+
+// SOCKS5 as in RFC 1928, only CONNECT without authentication is supported
+const (
+	socksVersion = 5
+
+	socksNoAuth       = 0x00
+	socksNoAcceptable = 0xff
+
+	socksConnect = 0x01
+
+	socksIPv4   = 0x01
+	socksDomain = 0x03
+	socksIPv6   = 0x04
+
+	socksSucceeded           = 0x00
+	socksGeneralFailure      = 0x01
+	socksCommandNotSupported = 0x07
+	socksAddressNotSupported = 0x08
+)
+
+// parseDynamicForward parses a dynamic forward in the ssh -D format [bind_address:]port
+func parseDynamicForward(spec string) (string, error) {
+	host, port := "localhost", spec
+	if i := strings.LastIndex(spec, ":"); i >= 0 {
+		host, port = spec[:i], spec[i+1:]
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return "", fmt.Errorf("invalid dynamic forward %s, expected [bind_address:]port", spec)
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), port), nil
+}
+
+func (cmd *SSHCmd) startDynamicForwards(ctx context.Context, sshClient *ssh.Client, log log.Logger) {
+	for _, spec := range cmd.DynamicForwards {
+		localAddr, err := parseDynamicForward(spec)
+		if err != nil {
+			log.Warnf("%v", err)
+			continue
+		}
+
+		go func() {
+			log.Infof("SOCKS5 proxy on %s into the container network", localAddr)
+			err := serveSocks(ctx, sshClient, localAddr, log)
+			if err != nil && ctx.Err() == nil {
+				log.Warnf("Error serving SOCKS5 proxy on %s: %v", localAddr, err)
+			}
+		}()
+	}
+}
+
+// serveSocks runs a SOCKS5 server on localAddr that connects through direct-tcpip
+// channels. Names are passed on unresolved, so the pod resolves cluster DNS names.
+func serveSocks(ctx context.Context, sshClient *ssh.Client, localAddr string, log log.Logger) error {
+	listener, err := net.Listen("tcp", localAddr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			defer conn.Close()
+			err := handleSocks(sshClient, conn)
+			if err != nil {
+				log.Debugf("SOCKS5 connection from %s: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+func handleSocks(sshClient *ssh.Client, conn net.Conn) error {
+	// greeting: version, number of methods, methods
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	if header[0] != socksVersion {
+		return fmt.Errorf("unsupported socks version %d", header[0])
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return err
+	}
+	method := byte(socksNoAcceptable)
+	for _, m := range methods {
+		if m == socksNoAuth {
+			method = socksNoAuth
+		}
+	}
+	if _, err := conn.Write([]byte{socksVersion, method}); err != nil {
+		return err
+	}
+	if method == socksNoAcceptable {
+		return fmt.Errorf("client doesn't support connecting without authentication")
+	}
+
+	// request: version, command, reserved, address
+	request := make([]byte, 3)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return err
+	}
+	addr, err := readSocksAddr(conn)
+	if err != nil {
+		_ = writeSocksReply(conn, socksAddressNotSupported)
+		return err
+	}
+	if request[1] != socksConnect {
+		_ = writeSocksReply(conn, socksCommandNotSupported)
+		return fmt.Errorf("unsupported socks command %d", request[1])
+	}
+
+	remote, err := sshClient.Dial("tcp", addr)
+	if err != nil {
+		_ = writeSocksReply(conn, socksGeneralFailure)
+		return fmt.Errorf("connect to %s: %w", addr, err)
+	}
+	defer remote.Close()
+	if err := writeSocksReply(conn, socksSucceeded); err != nil {
+		return err
+	}
+
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(remote, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(conn, remote)
+		done <- struct{}{}
+	}()
+	<-done
+	return nil
+}
+
+func readSocksAddr(reader io.Reader) (string, error) {
+	addrType := make([]byte, 1)
+	if _, err := io.ReadFull(reader, addrType); err != nil {
+		return "", err
+	}
+
+	var host string
+	switch addrType[0] {
+	case socksIPv4, socksIPv6:
+		ip := make([]byte, net.IPv4len)
+		if addrType[0] == socksIPv6 {
+			ip = make([]byte, net.IPv6len)
+		}
+		if _, err := io.ReadFull(reader, ip); err != nil {
+			return "", err
+		}
+		host = net.IP(ip).String()
+	case socksDomain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(reader, length); err != nil {
+			return "", err
+		}
+		domain := make([]byte, length[0])
+		if _, err := io.ReadFull(reader, domain); err != nil {
+			return "", err
+		}
+		host = string(domain)
+	default:
+		return "", fmt.Errorf("unsupported socks address type %d", addrType[0])
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(reader, port); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+// writeSocksReply answers a request, the bound address isn't known and left empty
+func writeSocksReply(writer io.Writer, reply byte) error {
+	_, err := writer.Write([]byte{socksVersion, reply, 0, socksIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
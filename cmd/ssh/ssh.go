@@ -6,10 +6,14 @@ import (
 	"io"
 	"os"
 	"sync"
+	"time"
 
+	"github.com/2017fighting/devssh/cmd/completion"
 	"github.com/2017fighting/devssh/pkg/agent"
 	"github.com/2017fighting/devssh/pkg/client"
 	"github.com/2017fighting/devssh/pkg/kubernetes"
+	"github.com/2017fighting/devssh/pkg/profile"
+	"github.com/2017fighting/devssh/pkg/ssh/terminal"
 	"github.com/mattn/go-isatty"
 	"github.com/pkg/errors"
 
@@ -22,47 +26,140 @@ import (
 	// "github.com/loft-sh/devpod/pkg/agent/tunnelserver"
 	"github.com/2017fighting/devssh/pkg/agent/tunnelserver"
 	client2 "github.com/loft-sh/devpod/pkg/client"
+	"github.com/loft-sh/devpod/pkg/devcontainer/config"
 	"github.com/loft-sh/devpod/pkg/netstat"
 	devssh "github.com/loft-sh/devpod/pkg/ssh"
 
 	// "github.com/loft-sh/devpod/pkg/tunnel"
-	devsshagent "github.com/loft-sh/devpod/pkg/ssh/agent"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 type SSHCmd struct {
-	NameSpace string
-	Service   string
+	NameSpace  string
+	Service    string
+	Container  string
+	DebugImage string
+
+	Wait        bool
+	WaitTimeout time.Duration
+
+	Forwards        []string
+	DynamicForwards []string
+
+	Mounts []string
+
+	Env     []string
+	SendEnv []string
+	EnvFile string
+
+	ForwardX11         bool
+	GPGAgentForwarding bool
+	ForwardKubeConfig  bool
+	ForwardBrowser     bool
+	Clipboard          bool
+
+	Dotfiles       string
+	DotfilesDir    string
+	DotfilesScript string
+
+	ForwardAgent bool
+	NoAddKeys    bool
+	Identities   []string
+	AgentConfirm bool
+
+	Multiplex      bool
+	ControlPersist time.Duration
+
+	NoDevContainer bool
 
 	// Command string
 	User string
 	// WorkDir string
+
+	// userSet is whether --user was given, it wins over the remoteUser of the devcontainer.json
+	userSet      bool
+	devContainer *config.Result
 }
 
 // devssh ssh --
 func NewSSHCmd() *cobra.Command {
 	cmd := &SSHCmd{}
 	sshCmd := &cobra.Command{
-		Use:   "ssh",
+		Use:   "ssh [PROFILE]",
 		Short: "Starts a new ssh session to a container",
-		RunE: func(_ *cobra.Command, args []string) error {
+		Long: `Starts a new ssh session to a container.
+
+If a profile is given, its options are used for every flag that isn't set on the command line.
+
+Unless --no-devcontainer is given, the devcontainer.json of the local repository, or
+else of the workspace in the pod, is applied to the session: remoteUser, containerEnv
+and remoteEnv, forwardPorts, workspaceFolder and the postStartCommand and postAttachCommand.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			if len(args) == 1 {
+				err := applyProfile(c.Flags(), args[0])
+				if err != nil {
+					return err
+				}
+			}
+			cmd.userSet = c.Flags().Changed("user")
+
 			ctx := context.Background()
 			return cmd.Run(ctx, log.Default.ErrorStreamOnly())
 		},
+		ValidArgsFunction: func(_ *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+			if len(args) > 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			config, err := profile.Load()
+			if err != nil {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return config.Names(), cobra.ShellCompDirectiveNoFileComp
+		},
 	}
 	sshCmd.Flags().StringVar(&cmd.NameSpace, "ns", "", "The k8s namespace of the container")
 	sshCmd.Flags().StringVar(&cmd.Service, "svc", "", "The k8s service of the container")
+	sshCmd.Flags().StringVar(&cmd.Container, "container", "", "The container of the pod to connect to, defaults to the first one")
+	sshCmd.Flags().StringVar(&cmd.DebugImage, "debug-image", "", "Attach an ephemeral debug container with this image (it must ship devssh) and connect to it instead")
+	sshCmd.Flags().BoolVar(&cmd.Wait, "wait", false, "If the pod is still starting, wait until it is ready instead of failing")
+	sshCmd.Flags().DurationVar(&cmd.WaitTimeout, "wait-timeout", 5*time.Minute, "How long to wait for a ready pod with --wait")
+	sshCmd.Flags().StringArrayVarP(&cmd.Forwards, "forward", "L", []string{}, "Forward a local port to the container, in the format [bind_address:]port:host:hostport")
+	sshCmd.Flags().StringArrayVarP(&cmd.DynamicForwards, "dynamic-forward", "D", []string{}, "Run a local SOCKS5 proxy into the network of the pod, in the format [bind_address:]port")
+	sshCmd.Flags().StringArrayVar(&cmd.Mounts, "mount", []string{}, "Copy a local directory into the container on connect, in the format local_dir:remote_dir, honoring .devsshignore or .gitignore")
+	sshCmd.Flags().StringArrayVar(&cmd.Env, "env", []string{}, "Set an environment variable in the container, in the format KEY=VALUE")
+	sshCmd.Flags().StringArrayVar(&cmd.SendEnv, "send-env", []string{}, "Send the local environment variables matching this glob pattern, e.g. 'LC_*'")
+	sshCmd.Flags().StringVar(&cmd.EnvFile, "env-file", "", "Send the environment variables of this file, one KEY=VALUE per line")
+	sshCmd.Flags().BoolVarP(&cmd.ForwardX11, "forward-x11", "X", false, "Forward X11 connections of the container to the local $DISPLAY")
+	sshCmd.Flags().BoolVar(&cmd.GPGAgentForwarding, "gpg-agent-forwarding", false, "Forward the local gpg-agent and sign git commits in the container with it")
+	sshCmd.Flags().BoolVar(&cmd.ForwardKubeConfig, "forward-kubeconfig", false, "Write the kubeconfig of the current context to a file in the container for the session and point KUBECONFIG at it")
+	sshCmd.Flags().BoolVar(&cmd.ForwardBrowser, "forward-browser", false, "Open the urls the container opens with $BROWSER or xdg-open in the local browser")
+	sshCmd.Flags().BoolVar(&cmd.Clipboard, "clipboard", false, "Copy to the local clipboard from OSC 52 sequences and 'devssh agent copy' in the container")
+	sshCmd.Flags().StringVar(&cmd.Dotfiles, "dotfiles", "", "Clone this git repository with dotfiles and run its install script on the first connect to a pod")
+	sshCmd.Flags().StringVar(&cmd.DotfilesDir, "dotfiles-dir", "", "Copy this local directory with dotfiles and run its install script on the first connect to a pod")
+	sshCmd.Flags().StringVar(&cmd.DotfilesScript, "dotfiles-script", "", "The install script in the dotfiles, defaults to install.sh, bootstrap.sh, setup.sh and the like")
+	sshCmd.Flags().BoolVar(&cmd.ForwardAgent, "forward-agent", true, "Forward the local ssh-agent to the container")
+	sshCmd.Flags().BoolVar(&cmd.NoAddKeys, "no-add-keys", false, "Don't add the private keys of ~/.ssh to the local ssh-agent before forwarding it")
+	sshCmd.Flags().StringArrayVar(&cmd.Identities, "identity", []string{}, "Only forward this key of the ssh-agent, a fingerprint like SHA256:... or a key file")
+	sshCmd.Flags().BoolVar(&cmd.AgentConfirm, "agent-confirm", false, "Ask through SSH_ASKPASS before the container may use a forwarded key")
+	sshCmd.Flags().BoolVar(&cmd.Multiplex, "multiplex", false, "Share one connection to the container between invocations through a background master process")
+	sshCmd.Flags().DurationVar(&cmd.ControlPersist, "control-persist", 10*time.Minute, "How long the master process of --multiplex keeps the connection without sessions")
+	sshCmd.Flags().BoolVar(&cmd.NoDevContainer, "no-devcontainer", false, "Don't apply the devcontainer.json of the local repository or the workspace in the pod")
 	// sshCmd.Flags().StringVar(&cmd.Command, "command", "", "The command to execute within the workspace")
 	sshCmd.Flags().StringVar(&cmd.User, "user", "root", "The user of the pod to use")
 	// sshCmd.Flags().StringVar(&cmd.WorkDir, "workdir", "", "The working directory in the container")
+	completion.RegisterFlagCompletions(sshCmd)
 	return sshCmd
 }
 
 func (cmd *SSHCmd) Run(ctx context.Context, log log.Logger) error {
-	// add ssh keys to agent
-	err := devssh.AddPrivateKeysToAgent(ctx, log)
-	if err != nil {
-		log.Debugf("Error adding private keys to ssh-agent: %v", err)
+	// add ssh keys to agent, they are only used by the forwarded agent
+	if cmd.ForwardAgent && !cmd.NoAddKeys {
+		err := devssh.AddPrivateKeysToAgent(ctx, log)
+		if err != nil {
+			log.Debugf("Error adding private keys to ssh-agent: %v", err)
+		}
 	}
 	client := client.NewWorkspaceClient(cmd.NameSpace, cmd.Service, log)
 
@@ -77,24 +174,129 @@ func (cmd *SSHCmd) Run(ctx context.Context, log log.Logger) error {
 	if cmd.Service == "" {
 		return fmt.Errorf("please specify k8s service")
 	}
+	// the user and the forwards have to be known before connecting
+	if !cmd.NoDevContainer {
+		err := cmd.loadDevContainer(ctx, log)
+		if err != nil {
+			log.Warnf("Error reading devcontainer.json: %v", err)
+		}
+	}
+	for _, spec := range cmd.Forwards {
+		_, _, err := parseForward(spec)
+		if err != nil {
+			return err
+		}
+	}
+	for _, spec := range cmd.DynamicForwards {
+		_, err := parseDynamicForward(spec)
+		if err != nil {
+			return err
+		}
+	}
+	for _, spec := range cmd.Mounts {
+		_, err := parseMount(spec)
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := cmd.collectEnv(); err != nil {
+		return err
+	}
+	if cmd.Dotfiles != "" && cmd.DotfilesDir != "" {
+		return fmt.Errorf("please specify either --dotfiles or --dotfiles-dir")
+	} else if cmd.DotfilesDir != "" {
+		stat, err := os.Stat(cmd.DotfilesDir)
+		if err != nil {
+			return fmt.Errorf("dotfiles dir: %w", err)
+		} else if !stat.IsDir() {
+			return fmt.Errorf("dotfiles dir %s is not a directory", cmd.DotfilesDir)
+		}
+	}
+	for _, identity := range cmd.Identities {
+		_, err := identityFingerprint(identity)
+		if err != nil {
+			return err
+		}
+	}
+
+	if cmd.Multiplex {
+		sshClient, podUID, err := cmd.dialMaster(ctx, log)
+		if err == nil {
+			defer sshClient.Close()
+			stderr := log.ErrorStreamOnly().Writer(logrus.InfoLevel, false)
+			defer stderr.Close()
+			return cmd.startService(ctx, sshClient, podUID, stderr)
+		}
+		log.Warnf("Error using the connection master, connecting directly: %v", err)
+	}
 
-	return cmd.jumpContainer(ctx, client)
+	return cmd.jumpContainer(ctx, client, cmd.startService)
 }
 
-func ensureRunning(
-	ctx context.Context,
-	client *client.WorkspaceClient,
-) error {
-	instanceStatus, err := client.Status(ctx)
+// applyProfile sets the flags that weren't given on the command line from the profile
+func applyProfile(flags *pflag.FlagSet, name string) error {
+	p, err := profile.Get(name)
 	if err != nil {
 		return err
 	}
-	if instanceStatus != client2.StatusRunning {
-		return fmt.Errorf("svc not running")
+
+	for flag, values := range p.Flags() {
+		if flags.Lookup(flag) == nil || flags.Changed(flag) {
+			continue
+		}
+		for _, value := range values {
+			err = flags.Set(flag, value)
+			if err != nil {
+				return fmt.Errorf("profile %s: invalid %s: %w", name, flag, err)
+			}
+		}
+	}
+
+	// the kube context was already selected before the profile was applied
+	if flag := flags.Lookup("context"); flag != nil {
+		kubernetes.SetContext(flag.Value.String())
 	}
 	return nil
 }
 
+// ensureRunning returns the name of a ready pod of the workspace, with --wait it
+// waits for one if the workspace is still starting
+func (cmd *SSHCmd) ensureRunning(
+	ctx context.Context,
+	workspaceClient *client.WorkspaceClient,
+) (string, error) {
+	info, err := workspaceClient.Info(ctx)
+	if err != nil {
+		return "", err
+	}
+	instanceStatus := client.StatusFromInfo(info)
+	if instanceStatus == client2.StatusRunning {
+		for _, pod := range info.Pods {
+			if pod.Ready {
+				return pod.Name, nil
+			}
+		}
+	} else if instanceStatus == client2.StatusBusy && cmd.Wait {
+		workspaceClient.Log.Infof("Wait up to %s for a ready pod of svc %s", cmd.WaitTimeout, cmd.Service)
+		return kubernetes.WaitForReadyPod(ctx, cmd.NameSpace, cmd.Service, cmd.WaitTimeout, workspaceClient.Log)
+	}
+
+	// tell the user what keeps the workspace from running
+	for _, problem := range info.Problems() {
+		workspaceClient.Log.Warn(problem)
+	}
+	switch instanceStatus {
+	case client2.StatusStopped:
+		return "", fmt.Errorf("svc is stopped, use 'devssh start' to start it")
+	case client.StatusUnmanaged:
+		return "", fmt.Errorf("svc has no pods and no deployment devssh could start, create its pod again")
+	case client2.StatusBusy:
+		return "", fmt.Errorf("svc is busy, use --wait to wait until its pods are ready")
+	default:
+		return "", fmt.Errorf("svc not running, use 'devssh up' to create it")
+	}
+}
+
 func (cmd *SSHCmd) startExtraService(ctx context.Context, sshClient *ssh.Client) error {
 	log.Default.Info("init extra service")
 	stdoutReader, stdoutWriter, err := os.Pipe()
@@ -158,7 +360,7 @@ func (cmd *SSHCmd) startExtraService(ctx context.Context, sshClient *ssh.Client)
 	return nil
 }
 
-func (cmd *SSHCmd) startService(ctx context.Context, sshClient *ssh.Client, stderr io.Writer) error {
+func (cmd *SSHCmd) startService(ctx context.Context, sshClient *ssh.Client, podUID string, stderr io.Writer) error {
 	// extra service
 	go cmd.startExtraService(ctx, sshClient)
 
@@ -172,24 +374,95 @@ func (cmd *SSHCmd) startService(ctx context.Context, sshClient *ssh.Client, stde
 		stdin  io.Reader = os.Stdin
 	)
 
+	// forward local ports
+	cmd.startForwards(ctx, sshClient, log.Default)
+	cmd.startDynamicForwards(ctx, sshClient, log.Default)
+
+	// env requests have to be sent before the shell is started
+	env, err := cmd.collectEnv()
+	if err != nil {
+		return err
+	}
+	if cmd.GPGAgentForwarding {
+		err = cmd.setupGPGAgent(ctx, sshClient, env, log.Default)
+		if err != nil {
+			log.Default.Warnf("GPG agent forwarding: %v", err)
+		}
+	}
+	if cmd.ForwardKubeConfig {
+		err = cmd.forwardKubeConfig(ctx, sshClient, env, log.Default)
+		if err != nil {
+			log.Default.Warnf("Kubeconfig forwarding: %v", err)
+		}
+	}
+	sendEnv(session, env, log.Default)
+
+	if cmd.ForwardX11 {
+		err = cmd.startX11(sshClient, session, log.Default)
+		if err != nil {
+			log.Default.Warnf("X11 forwarding: %v", err)
+		}
+	}
+
+	if cmd.ForwardBrowser || cmd.Clipboard {
+		err = cmd.startHostForward(sshClient, session, log.Default)
+		if err != nil {
+			log.Default.Warnf("Browser and clipboard forwarding: %v", err)
+		}
+	}
+
 	// request agent forwarding
-	authSock := devsshagent.GetSSHAuthSocket()
-	if authSock != "" {
-		err = devsshagent.ForwardToRemote(sshClient, authSock)
+	if cmd.ForwardAgent {
+		err = cmd.forwardAgent(sshClient, session, log.Default)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the shell should already start in the copied sources
+	if len(cmd.Mounts) > 0 {
+		err = cmd.copyMounts(ctx, sshClient, log.Default)
 		if err != nil {
-			return errors.Errorf("forward agent: %v", err)
+			return err
 		}
+	}
 
-		err = devsshagent.RequestAgentForwarding(session)
+	// the shell should already start with the dotfiles
+	if cmd.Dotfiles != "" || cmd.DotfilesDir != "" {
+		err = cmd.installDotfiles(ctx, sshClient, podUID, log.Default)
 		if err != nil {
-			return errors.Errorf("request agent forwarding: %v", err)
+			log.Default.Warnf("Error installing dotfiles: %v", err)
 		}
-		log.Default.Infof("forward auth sock success")
+	}
+
+	// the hooks run before the shell, like an editor attaching to a devcontainer
+	shellCommand := ""
+	if cmd.devContainer != nil {
+		err = cmd.runLifecycleHooks(ctx, sshClient, podUID, env, log.Default)
+		if err != nil {
+			log.Default.Warnf("Error running devcontainer.json hooks: %v", err)
+		}
+		shellCommand = cmd.devContainerShell(env)
 	}
 
 	stdoutFile, validOut := stdout.(*os.File)
 	stdinFile, validIn := stdin.(*os.File)
 	if validOut && validIn && isatty.IsTerminal(stdoutFile.Fd()) {
+		// the modes have to be read before the local terminal is switched to raw
+		modes, err := terminal.Modes(int(stdinFile.Fd()))
+		if err != nil {
+			log.Default.Debugf("Error reading terminal modes: %v", err)
+			modes = ssh.TerminalModes{}
+		}
+		width, height, err := term.GetSize(int(stdoutFile.Fd()))
+		if err != nil {
+			width, height = 80, 24
+		}
+		termName := os.Getenv("TERM")
+		if termName == "" {
+			termName = "xterm-256color"
+		}
+
 		state, err := term.MakeRaw(int(stdinFile.Fd()))
 		if err != nil {
 			return err
@@ -214,28 +487,27 @@ func (cmd *SSHCmd) startService(ctx context.Context, sshClient *ssh.Client, stde
 			}
 		}()
 
-		err = session.RequestPty("xterm-256color", 128, 128, ssh.TerminalModes{})
+		err = session.RequestPty(termName, height, width, modes)
 		if err != nil {
 			return err
 		}
 	}
 
+	if cmd.Clipboard {
+		stdout = &osc52Writer{out: stdout, log: log.Default}
+	}
 	session.Stdin = stdin
 	session.Stdout = stdout
 	session.Stderr = stderr
-	err = session.Shell()
+	if shellCommand != "" {
+		err = session.Start(shellCommand)
+	} else {
+		err = session.Shell()
+	}
 	if err != nil {
 		return err
 	}
 
-	// set correct window size
-	if validOut && validIn && isatty.IsTerminal(stdoutFile.Fd()) {
-		width, height, err := term.GetSize(int(stdoutFile.Fd()))
-		if err == nil {
-			_ = session.WindowChange(height, width)
-		}
-	}
-
 	// wait until done
 	err = session.Wait()
 	if err != nil {
@@ -245,20 +517,43 @@ func (cmd *SSHCmd) startService(ctx context.Context, sshClient *ssh.Client, stde
 	return nil
 }
 
-func (cmd *SSHCmd) jumpContainer(ctx context.Context, client *client.WorkspaceClient) error {
-	// lock workspace
+// jumpContainer connects to the container of the workspace and calls run with the connection
+func (cmd *SSHCmd) jumpContainer(
+	ctx context.Context,
+	client *client.WorkspaceClient,
+	run func(ctx context.Context, sshClient *ssh.Client, podUID string, stderr io.Writer) error,
+) error {
+	// lock workspace, sessions only wait for lifecycle operations and not for each
+	// other unless they change the pod with a debug container
 	unlockOnce := sync.Once{}
-	err := client.Lock(ctx)
+	lock := client.RLock
+	if cmd.DebugImage != "" {
+		lock = client.Lock
+	}
+	err := lock(ctx)
 	if err != nil {
 		return err
 	}
 	defer unlockOnce.Do(client.Unlock)
 
 	// ensure pod running
-	err = ensureRunning(ctx, client)
+	podName, err := cmd.ensureRunning(ctx, client)
 	if err != nil {
 		return err
 	}
+	podUID, err := kubernetes.GetPodUID(ctx, cmd.NameSpace, podName)
+	if err != nil {
+		return err
+	}
+
+	// attach a debug container for images without devssh or a shell
+	container := cmd.Container
+	if cmd.DebugImage != "" {
+		container, err = kubernetes.AttachDebugContainer(ctx, cmd.NameSpace, podName, cmd.Container, cmd.DebugImage, client.Log)
+		if err != nil {
+			return err
+		}
+	}
 
 	writer := client.Log.ErrorStreamOnly().Writer(logrus.InfoLevel, false)
 	defer writer.Close()
@@ -285,7 +580,9 @@ func (cmd *SSHCmd) jumpContainer(ctx context.Context, client *client.WorkspaceCl
 	go func() {
 		defer client.Log.Infof("tunnel to host closed")
 
-		tunnelChan <- kubernetes.Exec(cancelCtx, cmd.NameSpace, cmd.Service, stdinReader, stdoutWriter, stderr)
+		client.Log.Debugf("Start the ssh-server in pod %s", podName)
+		command := []string{agent.ContainerDevPodHelperLocation, "ssh-server"}
+		tunnelChan <- kubernetes.Exec(cancelCtx, cmd.NameSpace, podName, container, command, stdinReader, stdoutWriter, stderr)
 	}()
 
 	containerChan := make(chan error, 1)
@@ -302,7 +599,7 @@ func (cmd *SSHCmd) jumpContainer(ctx context.Context, client *client.WorkspaceCl
 		defer client.Log.Infof("Connection to container closed")
 		client.Log.Infof("Successfully connected to host")
 		unlockOnce.Do(client.Unlock)
-		containerChan <- errors.Wrap(cmd.startService(cancelCtx, sshClient, stderr), "run in container")
+		containerChan <- errors.Wrap(run(cancelCtx, sshClient, podUID, stderr), "run in container")
 	}()
 	select {
 	case err := <-containerChan:
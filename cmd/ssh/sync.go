@@ -0,0 +1,252 @@
+package ssh
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/2017fighting/devssh/cmd/completion"
+	"github.com/2017fighting/devssh/pkg/agent"
+	"github.com/2017fighting/devssh/pkg/client"
+	"github.com/2017fighting/devssh/pkg/filesync"
+	"github.com/2017fighting/devssh/pkg/kubernetes"
+	"github.com/alessio/shellescape"
+	"github.com/loft-sh/log"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+type SyncCmd struct {
+	SSHCmd
+
+	Prefer string
+}
+
+func NewSyncCmd() *cobra.Command {
+	cmd := &SyncCmd{}
+	syncCmd := &cobra.Command{
+		Use:   "sync LOCAL_DIR:REMOTE_DIR [PROFILE]",
+		Short: "Syncs a local directory with a directory in the container in both directions",
+		Long: `Syncs a local directory with a directory in the container in both directions.
+
+Both directories are compared first, then the changes on either side are synced as
+they happen. A path both sides changed since the last sync is a conflict and stays
+untouched, unless --prefer picks a side. The .devsshignore or .gitignore files of the
+local directory select what isn't synced. A new or empty directory in the container
+is merged with the local one instead of deleting the local files, and deleting more
+than 100 local files at once needs --prefer remote. The sync reconnects when the
+connection breaks, 'devssh sync status' shows the syncs and their conflicts.`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(c *cobra.Command, args []string) error {
+			if len(args) == 2 {
+				err := applyProfile(c.Flags(), args[1])
+				if err != nil {
+					return err
+				}
+			}
+			return cmd.Run(context.Background(), args[0], log.Default.ErrorStreamOnly())
+		},
+	}
+	syncCmd.Flags().StringVar(&cmd.NameSpace, "ns", "", "The k8s namespace of the container")
+	syncCmd.Flags().StringVar(&cmd.Service, "svc", "", "The k8s service of the container")
+	syncCmd.Flags().StringVar(&cmd.Container, "container", "", "The container of the pod to connect to, defaults to the first one")
+	syncCmd.Flags().StringVar(&cmd.User, "user", "root", "The user of the pod to sync as")
+	syncCmd.Flags().BoolVar(&cmd.Wait, "wait", false, "If the pod is still starting, wait until it is ready instead of failing")
+	syncCmd.Flags().DurationVar(&cmd.WaitTimeout, "wait-timeout", 5*time.Minute, "How long to wait for a ready pod with --wait")
+	syncCmd.Flags().BoolVar(&cmd.Multiplex, "multiplex", false, "Share one connection to the container between invocations through a background master process")
+	syncCmd.Flags().DurationVar(&cmd.ControlPersist, "control-persist", 10*time.Minute, "How long the master process of --multiplex keeps the connection without sessions")
+	syncCmd.Flags().StringVar(&cmd.Prefer, "prefer", "", "Resolve conflicts with the local or remote version")
+	_ = syncCmd.RegisterFlagCompletionFunc("prefer", cobra.FixedCompletions([]string{filesync.PreferLocal, filesync.PreferRemote}, cobra.ShellCompDirectiveNoFileComp))
+	completion.RegisterFlagCompletions(syncCmd)
+	syncCmd.AddCommand(NewSyncStatusCmd())
+	return syncCmd
+}
+
+func (cmd *SyncCmd) Run(ctx context.Context, spec string, log log.Logger) error {
+	if cmd.NameSpace == "" {
+		return fmt.Errorf("please specify k8s namespace")
+	}
+	if cmd.Service == "" {
+		return fmt.Errorf("please specify k8s service")
+	}
+	if cmd.User == "" {
+		cmd.User = "root"
+	}
+	if cmd.Prefer != "" && cmd.Prefer != filesync.PreferLocal && cmd.Prefer != filesync.PreferRemote {
+		return fmt.Errorf("invalid --prefer %s, use local or remote", cmd.Prefer)
+	}
+	local, remote, err := parseDirs(spec)
+	if err != nil {
+		return err
+	}
+
+	kubeContext, err := kubernetes.CurrentContext()
+	if err != nil {
+		return err
+	}
+	statePath, err := filesync.StatePath(kubeContext, cmd.NameSpace, cmd.Service, local, remote)
+	if err != nil {
+		return err
+	}
+	state, err := filesync.LoadState(statePath)
+	if err != nil {
+		return err
+	}
+	lock, err := state.Lock()
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	state.Local, state.Remote = local, remote
+	state.Context, state.Namespace, state.Service = kubeContext, cmd.NameSpace, cmd.Service
+	state.PID, state.Started, state.Connected = os.Getpid(), time.Now(), false
+	syncer := &filesync.Syncer{
+		Local:  local,
+		Prefer: cmd.Prefer,
+		State:  state,
+		Log:    log,
+	}
+
+	workspaceClient := client.NewWorkspaceClient(cmd.NameSpace, cmd.Service, log)
+	backoff := time.Second
+	for {
+		connected := atomic.Bool{}
+		run := func(ctx context.Context, sshClient *ssh.Client, podUID string, stderr io.Writer) error {
+			connected.Store(true)
+			return cmd.sync(ctx, sshClient, syncer, remote, log)
+		}
+
+		if cmd.Multiplex {
+			var sshClient *ssh.Client
+			sshClient, _, err = cmd.dialMaster(ctx, log)
+			if err == nil {
+				err = run(ctx, sshClient, "", nil)
+				_ = sshClient.Close()
+			}
+		} else {
+			err = cmd.jumpContainer(ctx, workspaceClient, run)
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		state.Connected, state.Error = false, fmt.Sprint(err)
+		_ = state.Save()
+		if connected.Load() {
+			backoff = time.Second
+		}
+		log.Warnf("Sync stopped: %v, reconnecting in %s", err, backoff)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, proxyMaxBackoff)
+	}
+}
+
+// sync runs 'devssh agent sync' in the container, its stdio is the channel the
+// changes are sent through
+func (cmd *SyncCmd) sync(ctx context.Context, sshClient *ssh.Client, syncer *filesync.Syncer, remote string, log log.Logger) error {
+	session, err := sshClient.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr := log.ErrorStreamOnly().Writer(logrus.InfoLevel, false)
+	defer stderr.Close()
+	session.Stderr = stderr
+
+	err = session.Start(fmt.Sprintf("'%s' agent sync --path %s", agent.ContainerDevPodHelperLocation, shellescape.Quote(remote)))
+	if err != nil {
+		return err
+	}
+	return syncer.Run(ctx, stdout, stdin)
+}
+
+type SyncStatusCmd struct {
+	Output string
+}
+
+func NewSyncStatusCmd() *cobra.Command {
+	cmd := &SyncStatusCmd{}
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Shows the synced directories and their conflicts",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, args []string) error {
+			return cmd.Run()
+		},
+	}
+	statusCmd.Flags().StringVarP(&cmd.Output, "output", "o", "table", "The output format, table or json")
+	return statusCmd
+}
+
+func (cmd *SyncStatusCmd) Run() error {
+	states, err := filesync.ListStates()
+	if err != nil {
+		return err
+	}
+
+	switch cmd.Output {
+	case "json":
+		for _, state := range states {
+			state.Base = nil
+		}
+		raw, err := json.MarshalIndent(states, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(raw))
+		return nil
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "LOCAL\tREMOTE\tNAMESPACE\tSERVICE\tSTATE\tUPLOADED\tDOWNLOADED\tCONFLICTS\tLAST SYNC")
+		for _, state := range states {
+			status := "stopped"
+			if state.Running && state.Connected {
+				status = "watching"
+			} else if state.Running {
+				status = "reconnecting"
+			}
+			lastSync := "-"
+			if !state.LastSync.IsZero() {
+				lastSync = time.Since(state.LastSync).Round(time.Second).String() + " ago"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%d\t%d\t%s\n", state.Local, state.Remote, state.Namespace, state.Service, status, state.Pushed, state.Pulled, len(state.Conflicts), lastSync)
+		}
+		err = w.Flush()
+		if err != nil {
+			return err
+		}
+
+		for _, state := range states {
+			if len(state.Conflicts) == 0 {
+				continue
+			}
+			fmt.Printf("\nConflicts of %s, make both sides equal or sync again with --prefer:\n", state.Local)
+			for _, path := range state.Conflicts {
+				fmt.Printf("  %s\n", path)
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown output format %s, use table or json", cmd.Output)
+	}
+}
@@ -0,0 +1,49 @@
+package ssh
+
+import (
+	"context"
+	"os"
+
+	"github.com/2017fighting/devssh/pkg/agent/tunnelserver"
+	devssh "github.com/loft-sh/devpod/pkg/ssh"
+	"github.com/loft-sh/log"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// runAgentWithTunnel runs the agent command in the container and serves the tunnel
+// server with options to it through the stdio of the command until it exits
+func runAgentWithTunnel(ctx context.Context, sshClient *ssh.Client, command string, log log.Logger, options ...tunnelserver.Option) error {
+	stdoutReader, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer stdoutWriter.Close()
+	stdinReader, stdinWriter, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer stdinWriter.Close()
+
+	cancelCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		err := tunnelserver.RunServicesServer(
+			cancelCtx,
+			stdoutReader,
+			stdinWriter,
+			true,
+			false,
+			nil,
+			log,
+			append(options, tunnelserver.WithGitCredentialsOverride("", ""))...,
+		)
+		if err != nil && cancelCtx.Err() == nil {
+			log.Debugf("Error running tunnel server: %v", err)
+		}
+	}()
+
+	writer := log.ErrorStreamOnly().Writer(logrus.InfoLevel, false)
+	defer writer.Close()
+	return devssh.Run(cancelCtx, sshClient, command, stdinReader, stdoutWriter, writer)
+}
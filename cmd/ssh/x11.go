@@ -0,0 +1,227 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/loft-sh/log"
+	"golang.org/x/crypto/ssh"
+)
+
+const x11AuthProtocol = "MIT-MAGIC-COOKIE-1"
+
+// x11Display is the parsed local $DISPLAY
+type x11Display struct {
+	network string
+	address string
+	screen  uint32
+}
+
+func parseDisplay(display string) (*x11Display, error) {
+	colon := strings.LastIndex(display, ":")
+	if colon < 0 {
+		return nil, fmt.Errorf("invalid DISPLAY %q", display)
+	}
+	host, number := display[:colon], display[colon+1:]
+	screen := uint32(0)
+	if dot := strings.Index(number, "."); dot >= 0 {
+		s, err := strconv.ParseUint(number[dot+1:], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DISPLAY %q", display)
+		}
+		screen, number = uint32(s), number[:dot]
+	}
+	n, err := strconv.Atoi(number)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DISPLAY %q", display)
+	}
+
+	switch {
+	case strings.HasPrefix(host, "/"):
+		// launchd sockets of XQuartz
+		return &x11Display{network: "unix", address: display[:colon] + ":" + number, screen: screen}, nil
+	case host == "" || host == "unix":
+		return &x11Display{network: "unix", address: "/tmp/.X11-unix/X" + number, screen: screen}, nil
+	default:
+		return &x11Display{network: "tcp", address: net.JoinHostPort(host, strconv.Itoa(6000+n)), screen: screen}, nil
+	}
+}
+
+// localX11Cookie returns the cookie of the local display, empty if the display needs none
+func localX11Cookie(display string) []byte {
+	out, err := exec.Command("xauth", "list", display).Output()
+	if err != nil {
+		return nil
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 3 && fields[1] == x11AuthProtocol {
+			cookie, err := hex.DecodeString(fields[2])
+			if err == nil {
+				return cookie
+			}
+		}
+	}
+	return nil
+}
+
+// x11Forward proxies the x11 channels of the container to the local display. The
+// container only gets a fake cookie, which is replaced by the real one here.
+type x11Forward struct {
+	display    *x11Display
+	fakeCookie []byte
+	realCookie []byte
+	log        log.Logger
+}
+
+// startX11 requests X11 forwarding for the session and handles the x11 channels
+func (cmd *SSHCmd) startX11(sshClient *ssh.Client, session *ssh.Session, log log.Logger) error {
+	displayName := os.Getenv("DISPLAY")
+	if displayName == "" {
+		return fmt.Errorf("DISPLAY is not set")
+	}
+	display, err := parseDisplay(displayName)
+	if err != nil {
+		return err
+	}
+
+	forward := &x11Forward{
+		display:    display,
+		fakeCookie: make([]byte, 16),
+		realCookie: localX11Cookie(displayName),
+		log:        log,
+	}
+	_, err = rand.Read(forward.fakeCookie)
+	if err != nil {
+		return err
+	}
+
+	channels := sshClient.HandleChannelOpen("x11")
+	if channels == nil {
+		return fmt.Errorf("x11 channels are already handled")
+	}
+	go func() {
+		for newChannel := range channels {
+			go forward.handle(newChannel)
+		}
+	}()
+
+	ok, err := session.SendRequest("x11-req", true, ssh.Marshal(struct {
+		SingleConnection bool
+		AuthProtocol     string
+		AuthCookie       string
+		ScreenNumber     uint32
+	}{
+		AuthProtocol: x11AuthProtocol,
+		AuthCookie:   hex.EncodeToString(forward.fakeCookie),
+		ScreenNumber: display.screen,
+	}))
+	if err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("rejected by the ssh-server, is xauth installed in the container?")
+	}
+	return nil
+}
+
+func (f *x11Forward) handle(newChannel ssh.NewChannel) {
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+	go ssh.DiscardRequests(requests)
+
+	setup, err := f.replaceCookie(channel)
+	if err != nil {
+		f.log.Debugf("Rejected X11 connection: %v", err)
+		return
+	}
+
+	local, err := net.Dial(f.display.network, f.display.address)
+	if err != nil {
+		f.log.Debugf("Error connecting to the X11 display: %v", err)
+		return
+	}
+	defer local.Close()
+
+	_, err = local.Write(setup)
+	if err != nil {
+		return
+	}
+
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(local, channel)
+		if conn, ok := local.(interface{ CloseWrite() error }); ok {
+			_ = conn.CloseWrite()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(channel, local)
+		_ = channel.CloseWrite()
+	}()
+	wg.Wait()
+}
+
+// replaceCookie reads the connection setup of the X11 client and returns it with
+// the real cookie, it fails if the client didn't send the fake cookie
+func (f *x11Forward) replaceCookie(r io.Reader) ([]byte, error) {
+	header := make([]byte, 12)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, err
+	}
+
+	var order binary.ByteOrder
+	switch header[0] {
+	case 'B':
+		order = binary.BigEndian
+	case 'l':
+		order = binary.LittleEndian
+	default:
+		return nil, fmt.Errorf("invalid byte order %q", header[0])
+	}
+
+	nameLen, dataLen := int(order.Uint16(header[6:8])), int(order.Uint16(header[8:10]))
+	auth := make([]byte, pad4(nameLen)+pad4(dataLen))
+	_, err = io.ReadFull(r, auth)
+	if err != nil {
+		return nil, err
+	}
+	name, data := auth[:nameLen], auth[pad4(nameLen):pad4(nameLen)+dataLen]
+	if string(name) != x11AuthProtocol || !bytes.Equal(data, f.fakeCookie) {
+		return nil, fmt.Errorf("wrong authentication")
+	}
+
+	realName := []byte(x11AuthProtocol)
+	if len(f.realCookie) == 0 {
+		realName = nil
+	}
+	order.PutUint16(header[6:8], uint16(len(realName)))
+	order.PutUint16(header[8:10], uint16(len(f.realCookie)))
+
+	setup := append([]byte{}, header...)
+	setup = append(setup, realName...)
+	setup = append(setup, make([]byte, pad4(len(realName))-len(realName))...)
+	setup = append(setup, f.realCookie...)
+	setup = append(setup, make([]byte, pad4(len(f.realCookie))-len(f.realCookie))...)
+	return setup, nil
+}
+
+func pad4(n int) int {
+	return (n + 3) &^ 3
+}
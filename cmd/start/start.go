@@ -0,0 +1,66 @@
+package start
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/2017fighting/devssh/cmd/completion"
+	"github.com/2017fighting/devssh/pkg/client"
+	"github.com/2017fighting/devssh/pkg/kubernetes"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+type StartCmd struct {
+	NameSpace string
+	Service   string
+	Timeout   time.Duration
+}
+
+// devssh start --
+func NewStartCmd() *cobra.Command {
+	cmd := &StartCmd{}
+	startCmd := &cobra.Command{
+		Use:   "start",
+		Short: "Starts a stopped workspace and waits until it is ready",
+		RunE: func(_ *cobra.Command, args []string) error {
+			ctx := context.Background()
+			return cmd.Run(ctx, log.Default.ErrorStreamOnly())
+		},
+	}
+	startCmd.Flags().StringVar(&cmd.NameSpace, "ns", "", "The k8s namespace of the workspace")
+	startCmd.Flags().StringVar(&cmd.Service, "svc", "", "The k8s service of the workspace")
+	startCmd.Flags().DurationVar(&cmd.Timeout, "timeout", 5*time.Minute, "How long to wait for the workspace to become ready")
+	completion.RegisterFlagCompletions(startCmd)
+	return startCmd
+}
+
+func (cmd *StartCmd) Run(ctx context.Context, log log.Logger) error {
+	if cmd.NameSpace == "" {
+		return fmt.Errorf("please specify k8s namespace")
+	}
+	if cmd.Service == "" {
+		return fmt.Errorf("please specify k8s service")
+	}
+
+	client := client.NewWorkspaceClient(cmd.NameSpace, cmd.Service, log)
+	err := client.Lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Unlock()
+
+	err = kubernetes.ScaleWorkspace(ctx, cmd.NameSpace, cmd.Service, 1, log)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Wait for workspace %s/%s to become ready", cmd.NameSpace, cmd.Service)
+	_, err = kubernetes.WaitForReadyPod(ctx, cmd.NameSpace, cmd.Service, cmd.Timeout, log)
+	if err != nil {
+		return fmt.Errorf("wait for workspace: %w", err)
+	}
+	log.Donef("Started workspace %s/%s", cmd.NameSpace, cmd.Service)
+	return nil
+}
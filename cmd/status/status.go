@@ -0,0 +1,120 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/2017fighting/devssh/cmd/completion"
+	"github.com/2017fighting/devssh/pkg/client"
+	"github.com/2017fighting/devssh/pkg/kubernetes"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+type StatusCmd struct {
+	NameSpace string
+	Service   string
+	Output    string
+}
+
+type statusOutput struct {
+	*kubernetes.WorkspaceInfo
+	Status   string   `json:"status"`
+	Problems []string `json:"problems"`
+}
+
+// devssh status --
+func NewStatusCmd() *cobra.Command {
+	cmd := &StatusCmd{}
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Shows the status of a workspace and its pods",
+		RunE: func(_ *cobra.Command, args []string) error {
+			ctx := context.Background()
+			return cmd.Run(ctx, os.Stdout, log.Default.ErrorStreamOnly())
+		},
+	}
+	statusCmd.Flags().StringVar(&cmd.NameSpace, "ns", "", "The k8s namespace of the workspace")
+	statusCmd.Flags().StringVar(&cmd.Service, "svc", "", "The k8s service of the workspace")
+	statusCmd.Flags().StringVarP(&cmd.Output, "output", "o", "table", "The output format, one of table or json")
+	completion.RegisterFlagCompletions(statusCmd)
+	return statusCmd
+}
+
+func (cmd *StatusCmd) Run(ctx context.Context, out io.Writer, log log.Logger) error {
+	if cmd.NameSpace == "" {
+		return fmt.Errorf("please specify k8s namespace")
+	}
+	if cmd.Service == "" {
+		return fmt.Errorf("please specify k8s service")
+	}
+
+	info, err := client.NewWorkspaceClient(cmd.NameSpace, cmd.Service, log).Info(ctx)
+	if err != nil {
+		return err
+	}
+	status := statusOutput{
+		WorkspaceInfo: info,
+		Status:        string(client.StatusFromInfo(info)),
+		Problems:      info.Problems(),
+	}
+
+	switch cmd.Output {
+	case "json":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(status)
+	case "table":
+		return printTable(out, status)
+	default:
+		return fmt.Errorf("unknown output format %s, expected table or json", cmd.Output)
+	}
+}
+
+func printTable(out io.Writer, status statusOutput) error {
+	fmt.Fprintf(out, "Workspace %s/%s is %s\n", status.Namespace, status.Service, status.Status)
+	if len(status.Pods) > 0 {
+		fmt.Fprintln(out)
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "POD\tREADY\tSTATUS\tRESTARTS\tAGE\tNODE\tIMAGES")
+		for _, pod := range status.Pods {
+			ready := 0
+			images := []string{}
+			for _, container := range pod.Containers {
+				if container.Ready {
+					ready++
+				}
+				images = append(images, container.Image)
+			}
+			fmt.Fprintf(w, "%s\t%d/%d\t%s\t%d\t%s\t%s\t%s\n",
+				pod.Name,
+				ready, len(pod.Containers),
+				pod.Status(),
+				pod.Restarts(),
+				duration.HumanDuration(time.Since(pod.Created)),
+				pod.Node,
+				strings.Join(images, ","),
+			)
+		}
+		err := w.Flush()
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(status.Problems) > 0 {
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Problems:")
+		for _, problem := range status.Problems {
+			fmt.Fprintf(out, "  - %s\n", problem)
+		}
+	}
+	return nil
+}
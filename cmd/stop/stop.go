@@ -0,0 +1,57 @@
+package stop
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/2017fighting/devssh/cmd/completion"
+	"github.com/2017fighting/devssh/pkg/client"
+	"github.com/2017fighting/devssh/pkg/kubernetes"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+type StopCmd struct {
+	NameSpace string
+	Service   string
+}
+
+// devssh stop --
+func NewStopCmd() *cobra.Command {
+	cmd := &StopCmd{}
+	stopCmd := &cobra.Command{
+		Use:   "stop",
+		Short: "Stops a workspace by scaling it to zero, its volume is kept",
+		RunE: func(_ *cobra.Command, args []string) error {
+			ctx := context.Background()
+			return cmd.Run(ctx, log.Default.ErrorStreamOnly())
+		},
+	}
+	stopCmd.Flags().StringVar(&cmd.NameSpace, "ns", "", "The k8s namespace of the workspace")
+	stopCmd.Flags().StringVar(&cmd.Service, "svc", "", "The k8s service of the workspace")
+	completion.RegisterFlagCompletions(stopCmd)
+	return stopCmd
+}
+
+func (cmd *StopCmd) Run(ctx context.Context, log log.Logger) error {
+	if cmd.NameSpace == "" {
+		return fmt.Errorf("please specify k8s namespace")
+	}
+	if cmd.Service == "" {
+		return fmt.Errorf("please specify k8s service")
+	}
+
+	client := client.NewWorkspaceClient(cmd.NameSpace, cmd.Service, log)
+	err := client.Lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Unlock()
+
+	err = kubernetes.ScaleWorkspace(ctx, cmd.NameSpace, cmd.Service, 0, log)
+	if err != nil {
+		return err
+	}
+	log.Donef("Stopped workspace %s/%s", cmd.NameSpace, cmd.Service)
+	return nil
+}
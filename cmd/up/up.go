@@ -0,0 +1,98 @@
+package up
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/2017fighting/devssh/cmd/completion"
+	ssh2 "github.com/2017fighting/devssh/cmd/ssh"
+	"github.com/2017fighting/devssh/pkg/client"
+	"github.com/2017fighting/devssh/pkg/kubernetes"
+	client2 "github.com/loft-sh/devpod/pkg/client"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+type UpCmd struct {
+	ssh2.SSHCmd
+
+	Image    string
+	Template string
+	Storage  string
+	Timeout  time.Duration
+}
+
+// devssh up --
+func NewUpCmd() *cobra.Command {
+	cmd := &UpCmd{SSHCmd: ssh2.SSHCmd{ForwardAgent: true}}
+	upCmd := &cobra.Command{
+		Use:   "up",
+		Short: "Creates a workspace if it doesn't exist and starts a new ssh session to it",
+		RunE: func(_ *cobra.Command, args []string) error {
+			ctx := context.Background()
+			return cmd.Run(ctx, log.Default.ErrorStreamOnly())
+		},
+	}
+	upCmd.Flags().StringVar(&cmd.NameSpace, "ns", "", "The k8s namespace of the workspace")
+	upCmd.Flags().StringVar(&cmd.Service, "svc", "", "The k8s service of the workspace")
+	upCmd.Flags().StringVar(&cmd.User, "user", "root", "The user of the pod to use")
+	upCmd.Flags().StringVar(&cmd.Container, "container", "", "The container of the pod to connect to, defaults to the first one")
+	upCmd.Flags().StringVar(&cmd.Image, "image", "", "The image to create the workspace deployment from")
+	upCmd.Flags().StringVar(&cmd.Template, "template", "", "A pod or deployment manifest to create the workspace from")
+	upCmd.Flags().StringVar(&cmd.Storage, "storage", "", "If specified, mounts a persistent volume of this size at "+kubernetes.WorkspaceMountPath)
+	upCmd.Flags().DurationVar(&cmd.Timeout, "timeout", 5*time.Minute, "How long to wait for the workspace to become ready")
+	completion.RegisterFlagCompletions(upCmd)
+	return upCmd
+}
+
+func (cmd *UpCmd) Run(ctx context.Context, log log.Logger) error {
+	if cmd.NameSpace == "" {
+		return fmt.Errorf("please specify k8s namespace")
+	}
+	if cmd.Service == "" {
+		return fmt.Errorf("please specify k8s service")
+	}
+
+	client := client.NewWorkspaceClient(cmd.NameSpace, cmd.Service, log)
+	err := cmd.create(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Wait for workspace %s/%s to become ready", cmd.NameSpace, cmd.Service)
+	_, err = kubernetes.WaitForReadyPod(ctx, cmd.NameSpace, cmd.Service, cmd.Timeout, log)
+	if err != nil {
+		return fmt.Errorf("wait for workspace: %w", err)
+	}
+
+	return cmd.SSHCmd.Run(ctx, log)
+}
+
+func (cmd *UpCmd) create(ctx context.Context, client *client.WorkspaceClient) error {
+	err := client.Lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Unlock()
+
+	status, err := client.Status(ctx)
+	if err != nil {
+		return err
+	}
+	if status == client2.StatusStopped {
+		client.Log.Infof("Workspace %s/%s is stopped, start it", cmd.NameSpace, cmd.Service)
+		return kubernetes.ScaleWorkspace(ctx, cmd.NameSpace, cmd.Service, 1, client.Log)
+	} else if status != client2.StatusNotFound {
+		client.Log.Infof("Workspace %s/%s already exists", cmd.NameSpace, cmd.Service)
+		return nil
+	}
+
+	return kubernetes.CreateWorkspace(ctx, kubernetes.WorkspaceOptions{
+		Namespace: cmd.NameSpace,
+		Service:   cmd.Service,
+		Image:     cmd.Image,
+		Template:  cmd.Template,
+		Storage:   cmd.Storage,
+	}, client.Log)
+}
@@ -0,0 +1,5 @@
+package agent
+
+// PostStartMarker is the file in the home of the user holding the uid of the pod and the
+// start of the container the postStartCommand of the devcontainer.json last ran in
+const PostStartMarker = ".devssh/poststart.uid"
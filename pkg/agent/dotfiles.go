@@ -0,0 +1,9 @@
+package agent
+
+// DotfilesMarker is the file in the home of the user holding the uid of the pod
+// the dotfiles were last installed in
+const DotfilesMarker = ".devssh/dotfiles.uid"
+
+// DotfilesDir is where the dotfiles are cloned or copied to in the home of the user,
+// next to the marker, it is replaced on every install so it can't be the user's own
+const DotfilesDir = ".devssh/dotfiles"
@@ -0,0 +1,7 @@
+package agent
+
+// GPGSetup is sent to 'devssh agent setup-gpg' as the first line of its stdin
+type GPGSetup struct {
+	PublicKeys []byte `json:"publicKeys,omitempty"`
+	OwnerTrust []byte `json:"ownerTrust,omitempty"`
+}
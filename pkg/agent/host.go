@@ -0,0 +1,22 @@
+package agent
+
+// HostSocketEnv points 'devssh agent open' and 'devssh agent copy' to the socket
+// that forwards their requests to the local machine of the session
+const HostSocketEnv = "DEVSSH_HOST_SOCKET"
+
+const (
+	HostActionOpen = "open"
+	HostActionCopy = "copy"
+)
+
+// HostRequest asks the local machine to open a url or to copy data to its clipboard
+type HostRequest struct {
+	Action string `json:"action"`
+	URL    string `json:"url,omitempty"`
+	Data   []byte `json:"data,omitempty"`
+}
+
+// HostResponse answers a HostRequest, Error is empty if it succeeded
+type HostResponse struct {
+	Error string `json:"error,omitempty"`
+}
@@ -0,0 +1,97 @@
+package tunnelserver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/loft-sh/devpod/pkg/agent/tunnel"
+	"github.com/loft-sh/devpod/pkg/extract"
+	"github.com/loft-sh/devpod/pkg/git"
+	"github.com/loft-sh/devpod/pkg/gitcredentials"
+	perrors "github.com/pkg/errors"
+)
+
+func (t *tunnelServer) GitUser(ctx context.Context, empty *tunnel.Empty) (*tunnel.Message, error) {
+	gitUser, err := gitcredentials.GetUser("")
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := json.Marshal(gitUser)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tunnel.Message{Message: string(out)}, nil
+}
+
+// GitCredentials answers the credential helper in the container with the local credentials
+func (t *tunnelServer) GitCredentials(ctx context.Context, message *tunnel.Message) (*tunnel.Message, error) {
+	if !t.allowGitCredentials {
+		return nil, fmt.Errorf("git credentials forbidden")
+	}
+
+	credentials := &gitcredentials.GitCredentials{}
+	err := json.Unmarshal([]byte(message.Message), credentials)
+	if err != nil {
+		return nil, perrors.Wrap(err, "decode git credentials request")
+	}
+
+	response, err := gitcredentials.GetCredentials(credentials, t.gitCredentialsOverride.username, t.gitCredentialsOverride.token)
+	if err != nil {
+		return nil, perrors.Wrap(err, "get git response")
+	}
+
+	out, err := json.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tunnel.Message{Message: string(out)}, nil
+}
+
+// StreamGitClone clones the repository of the workspace on this machine and streams it as tar
+func (t *tunnelServer) StreamGitClone(message *tunnel.Empty, stream tunnel.Tunnel_StreamGitCloneServer) error {
+	if t.workspace == nil {
+		return fmt.Errorf("workspace is nil")
+	} else if t.workspace.Source.GitRepository == "" {
+		return fmt.Errorf("invalid repository")
+	}
+
+	tempDir, err := os.MkdirTemp("", "devssh-git-clone-*")
+	if err != nil {
+		return fmt.Errorf("create temp dir: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cloneArgs := []string{"clone", t.workspace.Source.GitRepository, tempDir}
+	if t.workspace.Source.GitBranch != "" {
+		cloneArgs = append(cloneArgs, "--branch", t.workspace.Source.GitBranch)
+	}
+	t.log.Infof("Cloning %s", t.workspace.Source.GitRepository)
+	out, err := git.CommandContext(stream.Context(), cloneArgs...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git clone: %w: %s", err, out)
+	}
+
+	if t.workspace.Source.GitCommit != "" {
+		resetCmd := git.CommandContext(stream.Context(), "reset", "--hard", t.workspace.Source.GitCommit)
+		resetCmd.Dir = tempDir
+		out, err = resetCmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("git reset: %w: %s", err, out)
+		}
+	}
+
+	buf := bufio.NewWriterSize(NewStreamWriter(stream, t.log), 10*1024)
+	err = extract.WriteTar(buf, tempDir, false)
+	if err != nil {
+		return err
+	}
+
+	// make sure buffer is flushed
+	return buf.Flush()
+}
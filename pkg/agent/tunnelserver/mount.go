@@ -0,0 +1,40 @@
+package tunnelserver
+
+import (
+	"bufio"
+	"fmt"
+
+	"github.com/2017fighting/devssh/pkg/ignore"
+	"github.com/loft-sh/devpod/pkg/agent/tunnel"
+	"github.com/loft-sh/devpod/pkg/devcontainer/config"
+)
+
+// StreamMount streams the local directory of an allowed mount as tar, without the
+// files its .devsshignore or .gitignore leave out
+func (t *tunnelServer) StreamMount(message *tunnel.StreamMountRequest, stream tunnel.Tunnel_StreamMountServer) error {
+	var mount *config.Mount
+	for _, m := range t.mounts {
+		if m.String() == message.Mount {
+			mount = m
+			break
+		}
+	}
+	if mount == nil {
+		return fmt.Errorf("mount %s is not allowed to download", message.Mount)
+	}
+
+	matcher, err := ignore.Load(mount.Source)
+	if err != nil {
+		return err
+	}
+
+	t.log.Infof("Copying %s to %s", mount.Source, mount.Target)
+	buf := bufio.NewWriterSize(NewStreamWriter(stream, t.log), 10*1024)
+	err = ignore.WriteTar(buf, mount.Source, matcher)
+	if err != nil {
+		return err
+	}
+
+	// make sure buffer is flushed
+	return buf.Flush()
+}
@@ -2,10 +2,12 @@ package tunnelserver
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net"
 	"os"
+	"strings"
 
 	"github.com/go-logr/logr"
 	"github.com/loft-sh/devpod/pkg/agent/tunnel"
@@ -338,6 +340,41 @@ func (t *tunnelServer) Run(ctx context.Context, reader io.Reader, writer io.Writ
 	return err
 }
 
+func (t *tunnelServer) Ping(context.Context, *tunnel.Empty) (*tunnel.Empty, error) {
+	t.log.Debugf("Received ping from agent")
+	return &tunnel.Empty{}, nil
+}
+
+// SendResult stores the devcontainer.json result an agent command found in the container
+func (t *tunnelServer) SendResult(ctx context.Context, result *tunnel.Message) (*tunnel.Empty, error) {
+	parsedResult := &config.Result{}
+	err := json.Unmarshal([]byte(result.Message), parsedResult)
+	if err != nil {
+		return nil, err
+	}
+
+	t.result = parsedResult
+	return &tunnel.Empty{}, nil
+}
+
+// Log prints the messages of the tunnel logger of an agent command
+func (t *tunnelServer) Log(ctx context.Context, message *tunnel.LogMessage) (*tunnel.Empty, error) {
+	switch message.LogLevel {
+	case tunnel.LogLevel_DEBUG:
+		t.log.Debug(strings.TrimSpace(message.Message))
+	case tunnel.LogLevel_INFO:
+		t.log.Info(strings.TrimSpace(message.Message))
+	case tunnel.LogLevel_WARNING:
+		t.log.Warn(strings.TrimSpace(message.Message))
+	case tunnel.LogLevel_ERROR:
+		t.log.Error(strings.TrimSpace(message.Message))
+	case tunnel.LogLevel_DONE:
+		t.log.Done(strings.TrimSpace(message.Message))
+	}
+
+	return &tunnel.Empty{}, nil
+}
+
 func New(log log.Logger, options ...Option) *tunnelServer {
 	s := &tunnelServer{
 		log: log,
@@ -13,13 +13,13 @@ import (
 	"github.com/gofrs/flock"
 	"github.com/loft-sh/devpod/pkg/client"
 	"github.com/loft-sh/log"
-	"k8s.io/apimachinery/pkg/api/errors"
 )
 
 type WorkspaceClient struct {
 	m        sync.Mutex
 	lockOnce sync.Once
 	lock     *flock.Flock
+	lockDir  string
 
 	Service   string
 	Namespace string
@@ -34,7 +34,7 @@ func NewWorkspaceClient(namespace string, service string, log log.Logger) *Works
 	}
 }
 
-func printLogMessagePeriodically(message string, log log.Logger) chan struct{} {
+func printLogMessagePeriodically(message func() string, log log.Logger) chan struct{} {
 	done := make(chan struct{})
 	go func() {
 		for {
@@ -42,7 +42,7 @@ func printLogMessagePeriodically(message string, log log.Logger) chan struct{} {
 			case <-done:
 				return
 			case <-time.After(time.Second * 5):
-				log.Info(message)
+				log.Info(message())
 			}
 		}
 	}()
@@ -50,13 +50,15 @@ func printLogMessagePeriodically(message string, log log.Logger) chan struct{} {
 	return done
 }
 
-func tryLock(ctx context.Context, lock *flock.Flock, name string, log log.Logger) error {
-	done := printLogMessagePeriodically(fmt.Sprintf("Trying to lock %s, seems like another process is running that blocks this %s", name, name), log)
+func tryLock(ctx context.Context, lockFn func() (bool, error), lockDir string, name string, log log.Logger) error {
+	done := printLogMessagePeriodically(func() string {
+		return fmt.Sprintf("Trying to lock %s, %s", name, describeHolders(readHolders(lockDir)))
+	}, log)
 	defer close(done)
 
 	now := time.Now()
 	for time.Since(now) < time.Minute*5 {
-		locked, err := lock.TryLock()
+		locked, err := lockFn()
 		if err != nil {
 			return err
 		} else if locked {
@@ -80,46 +82,97 @@ func (s *WorkspaceClient) initLock() {
 		defer s.m.Unlock()
 
 		// get locks dir
-		workspaceLockDir, err := provider.GetLocksDir(s.Service)
+		kubeContext, err := kubernetes.CurrentContext()
+		if err != nil {
+			panic(err)
+		}
+		workspaceLockDir, err := provider.GetLocksDir(kubeContext, s.Namespace, s.Service)
 		if err != nil {
 			panic(fmt.Errorf("get lock dir: %w", err))
 		}
 		_ = os.MkdirAll(workspaceLockDir, 0777)
 
 		// create workspace lock
-		s.lock = flock.New(filepath.Join(workspaceLockDir, "workspace.lock"))
+		s.lockDir = workspaceLockDir
+		s.lock = flock.New(filepath.Join(workspaceLockDir, lockFileName))
 	})
 
 }
+
+// Lock takes the exclusive workspace lock, it is meant for operations that change the workspace
 func (s *WorkspaceClient) Lock(ctx context.Context) error {
 	s.initLock()
-	s.Log.Debugf("Acquire lock...")
-	err := tryLock(ctx, s.lock, "workspace", s.Log)
+	return s.acquire(ctx, s.lock.TryLock, LockExclusive)
+}
+
+// RLock takes the shared workspace lock, sessions only wait for lifecycle operations
+// holding the exclusive lock and not for each other
+func (s *WorkspaceClient) RLock(ctx context.Context) error {
+	s.initLock()
+	return s.acquire(ctx, s.lock.TryRLock, LockShared)
+}
+
+func (s *WorkspaceClient) acquire(ctx context.Context, lockFn func() (bool, error), mode LockMode) error {
+	s.Log.Debugf("Acquire %s lock...", mode)
+	err := tryLock(ctx, lockFn, s.lockDir, "workspace", s.Log)
 	if err != nil {
 		return fmt.Errorf("error locking workspace: %w", err)
 	}
-	s.Log.Debugf("Acquired workspace lock...")
+	err = writeHolder(s.lockDir, currentHolder(mode))
+	if err != nil {
+		s.Log.Debugf("Error writing lock holder: %v", err)
+	}
+	s.Log.Debugf("Acquired %s workspace lock...", mode)
 	return nil
 }
 
 func (s *WorkspaceClient) Unlock() {
 	s.initLock()
 
+	removeHolder(s.lockDir, os.Getpid())
 	err := s.lock.Unlock()
 	if err != nil {
 		s.Log.Warnf("Error unlocking workspace: %v", err)
 	}
 }
 
+// Info returns the state of the pods behind the workspace service
+func (s *WorkspaceClient) Info(ctx context.Context) (*kubernetes.WorkspaceInfo, error) {
+	info, err := kubernetes.GetWorkspaceInfo(ctx, s.Namespace, s.Service)
+	if err != nil {
+		return nil, fmt.Errorf("get workspace in k8s: %w", err)
+	}
+	return info, nil
+}
+
 func (s *WorkspaceClient) Status(ctx context.Context) (client.Status, error) {
-	err := kubernetes.IsSVCRunning(s.Namespace, s.Service)
-	if errors.IsNotFound(err) {
-		return client.StatusNotFound, nil
-	} else if statusError, isStatus := err.(*errors.StatusError); isStatus {
-		panic(fmt.Errorf("get svc in k8s: %v", statusError.ErrStatus.Message))
-	} else if err != nil {
-		panic(fmt.Errorf("get svc in k8s: %w", err))
+	info, err := s.Info(ctx)
+	if err != nil {
+		return "", err
+	}
+	return StatusFromInfo(info), nil
+}
+
+// StatusUnmanaged is a service without pods and without a deployment, devssh start
+// can't bring it back, e.g. one whose bare pod was deleted
+const StatusUnmanaged client.Status = "Unmanaged"
+
+// StatusFromInfo computes the workspace status from its pods: the workspace is running
+// as soon as one pod is ready, busy while pods are starting, restarting or terminating
+// and stopped if its deployment has no pods. A bare pod counts the same way.
+func StatusFromInfo(info *kubernetes.WorkspaceInfo) client.Status {
+	if !info.Found {
+		return client.StatusNotFound
+	}
+	for _, pod := range info.Pods {
+		if pod.Ready {
+			return client.StatusRunning
+		}
+	}
+	if len(info.Pods) > 0 || (info.Deployment != "" && info.Replicas > 0) {
+		return client.StatusBusy
+	} else if info.Deployment == "" {
+		return StatusUnmanaged
 	}
-	log.Default.Info("running")
-	return client.StatusRunning, nil
+	return client.StatusStopped
 }
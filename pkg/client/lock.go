@@ -0,0 +1,292 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/2017fighting/devssh/pkg/provider"
+	"github.com/gofrs/flock"
+)
+
+const (
+	lockFileName   = "workspace.lock"
+	holdersDirName = "workspace.lock.holders"
+)
+
+type LockMode string
+
+const (
+	// LockShared is taken to connect, any number of sessions can hold it at once
+	LockShared LockMode = "shared"
+	// LockExclusive is taken by lifecycle operations like up, stop and delete
+	LockExclusive LockMode = "exclusive"
+)
+
+// LockHolder describes a process holding a workspace lock, every holder writes one
+// file into the holders dir next to the lock
+type LockHolder struct {
+	PID     int       `json:"pid"`
+	Mode    LockMode  `json:"mode"`
+	Command string    `json:"command"`
+	Started time.Time `json:"started"`
+}
+
+// Alive reports whether the holding process is still running
+func (h *LockHolder) Alive() bool {
+	return processAlive(h.PID)
+}
+
+func (h *LockHolder) String() string {
+	return fmt.Sprintf("pid %d (%s) since %s", h.PID, h.Command, h.Started.Format(time.RFC3339))
+}
+
+func currentHolder(mode LockMode) *LockHolder {
+	return &LockHolder{
+		PID:     os.Getpid(),
+		Mode:    mode,
+		Command: strings.Join(os.Args, " "),
+		Started: time.Now(),
+	}
+}
+
+func holderPath(dir string, pid int) string {
+	return filepath.Join(dir, holdersDirName, strconv.Itoa(pid)+".json")
+}
+
+func writeHolder(dir string, holder *LockHolder) error {
+	raw, err := json.Marshal(holder)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Join(dir, holdersDirName), 0o755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(holderPath(dir, holder.PID), raw, 0o644)
+}
+
+func removeHolder(dir string, pid int) {
+	_ = os.Remove(holderPath(dir, pid))
+}
+
+// readHolders returns the holders recorded in dir, the oldest first
+func readHolders(dir string) []*LockHolder {
+	entries, err := os.ReadDir(filepath.Join(dir, holdersDirName))
+	if err != nil {
+		return nil
+	}
+
+	holders := []*LockHolder{}
+	for _, entry := range entries {
+		raw, err := os.ReadFile(filepath.Join(dir, holdersDirName, entry.Name()))
+		if err != nil {
+			continue
+		}
+		holder := &LockHolder{}
+		if json.Unmarshal(raw, holder) == nil {
+			holders = append(holders, holder)
+		}
+	}
+	sort.Slice(holders, func(i, j int) bool {
+		return holders[i].Started.Before(holders[j].Started)
+	})
+	return holders
+}
+
+// describeHolders summarizes the holders for the waiting message
+func describeHolders(holders []*LockHolder) string {
+	alive := []*LockHolder{}
+	for _, holder := range holders {
+		if holder.Alive() {
+			alive = append(alive, holder)
+		}
+	}
+	switch {
+	case len(holders) == 0:
+		return "seems like another process is running that blocks it"
+	case len(alive) == 0:
+		return fmt.Sprintf("its holder %s is gone, use 'devssh locks break' if this doesn't resolve", holders[0])
+	case len(alive) == 1:
+		return fmt.Sprintf("it is held %s by %s", alive[0].Mode, alive[0])
+	default:
+		return fmt.Sprintf("it is held %s by %s and %d other processes", alive[0].Mode, alive[0], len(alive)-1)
+	}
+}
+
+type LockState string
+
+const (
+	LockFree  LockState = "Free"
+	LockHeld  LockState = "Held"
+	LockStale LockState = "Stale"
+)
+
+// LockInfo is a workspace lock found in the locks dir
+type LockInfo struct {
+	Context   string        `json:"context"`
+	Namespace string        `json:"namespace"`
+	Service   string        `json:"service"`
+	Dir       string        `json:"dir"`
+	State     LockState     `json:"state"`
+	Holders   []*LockHolder `json:"holders,omitempty"`
+}
+
+// inspectLock reports whether the lock in dir is held. A lock is stale if it is held
+// but all its recorded holders are gone, e.g. when a child inherited the lock.
+// Holder files of a free lock are left over by killed processes and removed.
+// The lock is only probed shared, unless nothing recorded is running, so sessions
+// connecting meanwhile aren't turned away.
+func inspectLock(dir string) (LockState, []*LockHolder, error) {
+	holders := readHolders(dir)
+	alive := false
+	for _, holder := range holders {
+		alive = alive || holder.Alive()
+	}
+
+	lock := flock.New(filepath.Join(dir, lockFileName))
+	defer lock.Unlock()
+	shared, err := lock.TryRLock()
+	if err != nil {
+		return "", nil, err
+	}
+	if shared && !alive {
+		locked, err := lock.TryLock()
+		if err != nil {
+			return "", nil, err
+		} else if locked {
+			for _, holder := range holders {
+				removeHolder(dir, holder.PID)
+			}
+			return LockFree, nil, nil
+		}
+	}
+
+	if alive {
+		return LockHeld, holders, nil
+	} else if len(holders) > 0 {
+		return LockStale, holders, nil
+	}
+	return LockHeld, holders, nil
+}
+
+// ListLocks returns all workspace locks of this machine
+func ListLocks() ([]*LockInfo, error) {
+	root, err := provider.GetLocksRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	locks := []*LockInfo{}
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if d.IsDir() || d.Name() != lockFileName {
+			return nil
+		}
+
+		dir := filepath.Dir(path)
+		rel, err := filepath.Rel(root, dir)
+		if err != nil {
+			return err
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if len(parts) != 3 {
+			return nil
+		}
+
+		state, holders, err := inspectLock(dir)
+		if err != nil {
+			return err
+		}
+		locks = append(locks, &LockInfo{
+			Context:   parts[0],
+			Namespace: parts[1],
+			Service:   parts[2],
+			Dir:       dir,
+			State:     state,
+			Holders:   holders,
+		})
+		return nil
+	})
+	return locks, err
+}
+
+// BreakLock clears the holder files in dir. The lock file itself is never removed, a
+// process waiting on it would get the lock of the unlinked file while the next one
+// locks a new file. Instead the processes holding the lock are terminated: for a stale
+// lock the ones that inherited it, for a held one the recorded holders, which needs
+// force. If the lock stays held the holder files are kept.
+func BreakLock(dir string, force bool) error {
+	path := filepath.Join(dir, lockFileName)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return fmt.Errorf("no lock found in %s", dir)
+	}
+	state, holders, err := inspectLock(dir)
+	if err != nil {
+		return err
+	}
+	switch state {
+	case LockFree:
+		return nil
+	case LockHeld:
+		if !force {
+			return fmt.Errorf("lock is held, %s, use --force to break it anyway", describeHolders(holders))
+		}
+		for _, holder := range holders {
+			if !holder.Alive() {
+				continue
+			}
+			err = terminateProcess(holder.PID)
+			if err != nil {
+				return fmt.Errorf("terminate holder %s: %w", holder, err)
+			}
+		}
+		if len(holders) > 0 && waitForLock(path) {
+			_ = os.RemoveAll(filepath.Join(dir, holdersDirName))
+			return nil
+		}
+	}
+
+	// what holds the lock now didn't record itself, it inherited the lock from a holder
+	owners, err := lockOwners(path)
+	if err != nil {
+		return fmt.Errorf("lock is held by a process that didn't record itself: %w", err)
+	} else if len(owners) == 0 {
+		return fmt.Errorf("lock is held by a process that didn't record itself and can't be found")
+	}
+	for _, pid := range owners {
+		err = terminateProcess(pid)
+		if err != nil {
+			return fmt.Errorf("terminate pid %d holding the lock: %w", pid, err)
+		}
+	}
+	if !waitForLock(path) {
+		return fmt.Errorf("lock is still held after terminating pids %v", owners)
+	}
+	_ = os.RemoveAll(filepath.Join(dir, holdersDirName))
+	return nil
+}
+
+// waitForLock waits a few seconds for terminated processes to release the lock at path
+func waitForLock(path string) bool {
+	lock := flock.New(path)
+	for i := 0; i < 20; i++ {
+		locked, err := lock.TryLock()
+		if err == nil && locked {
+			_ = lock.Unlock()
+			return true
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+	return false
+}
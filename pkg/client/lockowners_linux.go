@@ -0,0 +1,46 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// lockOwners returns the processes holding the flock of path. Only the fds sharing
+// the locked open file show the lock in their fdinfo, other processes waiting for
+// the lock have the file open as well.
+func lockOwners(path string) ([]int, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+
+	owners := []int{}
+	for _, proc := range procs {
+		pid, err := strconv.Atoi(proc.Name())
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+		fds, err := os.ReadDir(filepath.Join("/proc", proc.Name(), "fd"))
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			target, err := os.Readlink(filepath.Join("/proc", proc.Name(), "fd", fd.Name()))
+			if err != nil || target != path {
+				continue
+			}
+			info, err := os.ReadFile(filepath.Join("/proc", proc.Name(), "fdinfo", fd.Name()))
+			if err == nil && strings.Contains(string(info), "FLOCK") {
+				owners = append(owners, pid)
+				break
+			}
+		}
+	}
+	return owners, nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package client
+
+import "fmt"
+
+// lockOwners can't tell which process holds a flock outside of linux
+func lockOwners(path string) ([]int, error) {
+	return nil, fmt.Errorf("the process holding %s can't be looked up on this system", path)
+}
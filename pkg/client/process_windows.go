@@ -0,0 +1,33 @@
+//go:build windows
+
+package client
+
+import "golang.org/x/sys/windows"
+
+// stillActive is the exit code of a running process
+const stillActive = 259
+
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	handle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer windows.CloseHandle(handle)
+
+	var code uint32
+	err = windows.GetExitCodeProcess(handle, &code)
+	return err == nil && code == stillActive
+}
+
+func terminateProcess(pid int) error {
+	handle, err := windows.OpenProcess(windows.PROCESS_TERMINATE, false, uint32(pid))
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(handle)
+
+	return windows.TerminateProcess(handle, 1)
+}
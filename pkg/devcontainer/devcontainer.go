@@ -0,0 +1,108 @@
+package devcontainer
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/loft-sh/devpod/pkg/devcontainer/config"
+)
+
+// configPaths are the locations of the devcontainer.json in a folder, in the order of the spec
+var configPaths = []string{
+	".devcontainer/devcontainer.json",
+	".devcontainer.json",
+}
+
+// Find returns the relative path of the devcontainer.json in folder or an empty string
+func Find(folder string) string {
+	for _, configPath := range configPaths {
+		if stat, err := os.Stat(filepath.Join(folder, filepath.FromSlash(configPath))); err == nil && !stat.IsDir() {
+			return configPath
+		}
+	}
+	return ""
+}
+
+// Load parses the devcontainer.json of folder, or of the first of its subdirectories
+// that has one if searchSubdirs is set. The result is nil if there is none.
+func Load(folder string, searchSubdirs bool) (*config.Result, error) {
+	configPath := Find(folder)
+	if configPath == "" && searchSubdirs {
+		entries, err := os.ReadDir(folder)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+		for _, entry := range entries {
+			if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			if found := Find(filepath.Join(folder, entry.Name())); found != "" {
+				return Load(filepath.Join(folder, entry.Name()), false)
+			}
+		}
+	}
+	if configPath == "" {
+		return nil, nil
+	}
+
+	parsed, err := config.ParseDevContainerJSON(folder, configPath)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", configPath, err)
+	}
+	return &config.Result{
+		DevContainerConfigWithPath: &config.DevContainerConfigWithPath{
+			Config: parsed,
+			Path:   configPath,
+		},
+		SubstitutionContext: &config.SubstitutionContext{
+			LocalWorkspaceFolder: folder,
+		},
+	}, nil
+}
+
+// Resolve substitutes the variables of the devcontainer.json of result and sets its
+// merged config. Local variables are looked up in env, the workspace folder in the
+// container defaults to containerFolder.
+func Resolve(result *config.Result, localFolder string, containerFolder string, env map[string]string) error {
+	parsed := result.DevContainerConfigWithPath.Config
+	if parsed.WorkspaceFolder != "" {
+		containerFolder = parsed.WorkspaceFolder
+	}
+	result.SubstitutionContext = &config.SubstitutionContext{
+		LocalWorkspaceFolder:     localFolder,
+		ContainerWorkspaceFolder: path.Clean(containerFolder),
+		Env:                      env,
+	}
+
+	substituted := &config.DevContainerConfig{}
+	err := config.Substitute(result.SubstitutionContext, parsed, substituted)
+	if err != nil {
+		return fmt.Errorf("substitute variables: %w", err)
+	}
+	substituted.WorkspaceFolder = result.SubstitutionContext.ContainerWorkspaceFolder
+
+	// the config itself is the only metadata entry, there is no image with labels
+	result.MergedConfig, err = config.MergeConfiguration(substituted, []*config.ImageMetadata{{
+		DevContainerConfigBase: substituted.DevContainerConfigBase,
+		DevContainerActions:    substituted.DevContainerActions,
+		NonComposeBase:         substituted.NonComposeBase,
+	}})
+	return err
+}
+
+// Env returns the variables of the sessions, remoteEnv overrides containerEnv
+func Env(merged *config.MergedDevContainerConfig) map[string]string {
+	env := map[string]string{}
+	for name, value := range merged.ContainerEnv {
+		env[name] = value
+	}
+	for name, value := range merged.RemoteEnv {
+		env[name] = value
+	}
+	return env
+}
@@ -0,0 +1,260 @@
+package filesync
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/2017fighting/devssh/pkg/ignore"
+)
+
+// tempPrefix starts the names of files that are written, they are never synced
+const tempPrefix = ".devssh-sync-"
+
+// rootFile holds the id of a synced directory in the container
+const rootFile = tempPrefix + "root"
+
+// maxFileSize is the size of the largest file that is synced, a file is sent as a
+// whole in one message
+const maxFileSize = 64 << 20
+
+// ErrTooLarge is returned by Read for files larger than maxFileSize
+var ErrTooLarge = errors.New("file too large to sync")
+
+// Entry is a file, directory or symlink of a synced directory
+type Entry struct {
+	Path string `json:"path"`
+	Dir  bool   `json:"dir,omitempty"`
+	Link string `json:"link,omitempty"`
+	Exec bool   `json:"exec,omitempty"`
+	Hash string `json:"hash,omitempty"`
+}
+
+// Sum identifies the content of the entry, entries of equal sums don't have to be
+// synced. It is empty for entries that don't exist.
+func (e *Entry) Sum() string {
+	switch {
+	case e == nil:
+		return ""
+	case e.Dir:
+		return "dir"
+	case e.Link != "":
+		return "link:" + e.Link
+	case e.Exec:
+		return "exec:" + e.Hash
+	default:
+		return "file:" + e.Hash
+	}
+}
+
+// Read returns the entry at the slash separated path relative to dir and the content
+// of files, nil if there is none. Files larger than maxFileSize return ErrTooLarge.
+func Read(dir string, rel string) (*Entry, []byte, error) {
+	if !filepath.IsLocal(filepath.FromSlash(rel)) {
+		return nil, nil, fmt.Errorf("invalid path %s", rel)
+	}
+	err := checkParents(dir, filepath.FromSlash(rel))
+	if err != nil {
+		return nil, nil, err
+	}
+	file := filepath.Join(dir, filepath.FromSlash(rel))
+	info, err := os.Lstat(file)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	var data []byte
+	entry := &Entry{Path: rel}
+	switch {
+	case info.IsDir():
+		entry.Dir = true
+	case info.Mode()&os.ModeSymlink != 0:
+		entry.Link, err = os.Readlink(file)
+	case info.Mode().IsRegular():
+		if info.Size() > maxFileSize {
+			return nil, nil, fmt.Errorf("%s has more than %d MiB: %w", rel, maxFileSize>>20, ErrTooLarge)
+		}
+		entry.Exec = info.Mode()&0o100 != 0
+		data, err = os.ReadFile(file)
+		hash := sha256.Sum256(data)
+		entry.Hash = hex.EncodeToString(hash[:])
+	default:
+		// sockets, devices and pipes aren't synced
+		return nil, nil, nil
+	}
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	return entry, data, nil
+}
+
+// RootID returns the id of the synced directory dir, a directory without one gets a
+// new one. The base of the last sync only applies to the directory of the same id.
+func RootID(dir string) (string, error) {
+	file := filepath.Join(dir, rootFile)
+	raw, err := os.ReadFile(file)
+	if err == nil {
+		return strings.TrimSpace(string(raw)), nil
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	id := make([]byte, 8)
+	_, err = rand.Read(id)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), os.WriteFile(file, []byte(hex.EncodeToString(id)), 0o644)
+}
+
+// Scan returns the entries below dir that aren't ignored by their path and the paths
+// of the files too large to sync
+func Scan(dir string, matcher *ignore.Matcher) (map[string]*Entry, []string, error) {
+	entries := map[string]*Entry{}
+	large := []string{}
+	err := filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if skip(rel, matcher) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		entry, _, err := Read(dir, rel)
+		if errors.Is(err, ErrTooLarge) {
+			large = append(large, rel)
+			return nil
+		} else if err != nil {
+			return err
+		} else if entry != nil {
+			entries[rel] = entry
+		}
+		return nil
+	})
+	return entries, large, err
+}
+
+// skip reports whether the path isn't synced. The matchers of sync only have patterns,
+// they don't tell directories apart.
+func skip(rel string, matcher *ignore.Matcher) bool {
+	return strings.HasPrefix(filepath.Base(rel), tempPrefix) || matcher.Ignored(rel, false)
+}
+
+// Apply writes the entry with the content data below dir, replacing what is there
+func Apply(dir string, entry *Entry, data []byte) error {
+	rel := filepath.FromSlash(entry.Path)
+	if !filepath.IsLocal(rel) {
+		return fmt.Errorf("invalid path %s", entry.Path)
+	}
+	err := checkParents(dir, rel)
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(dir, rel)
+	err = os.MkdirAll(filepath.Dir(file), 0o755)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Lstat(file)
+	exists := err == nil
+	if entry.Dir {
+		if exists && !info.IsDir() {
+			_ = os.Remove(file)
+		}
+		return os.MkdirAll(file, 0o755)
+	} else if exists && info.IsDir() {
+		// the directory was replaced by a file
+		err = os.RemoveAll(file)
+		if err != nil {
+			return err
+		}
+	}
+
+	if entry.Link != "" {
+		_ = os.Remove(file)
+		return os.Symlink(entry.Link, file)
+	}
+
+	// the file is renamed into place, so it is never seen half written
+	temp, err := os.CreateTemp(filepath.Dir(file), tempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	_, err = temp.Write(data)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	mode := os.FileMode(0o644)
+	if entry.Exec {
+		mode = 0o755
+	}
+	err = os.Chmod(temp.Name(), mode)
+	if err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), file)
+}
+
+// Remove removes the entry at the slash separated path below dir, directories only
+// if they are empty
+func Remove(dir string, rel string) error {
+	if !filepath.IsLocal(filepath.FromSlash(rel)) {
+		return fmt.Errorf("invalid path %s", rel)
+	}
+	err := checkParents(dir, filepath.FromSlash(rel))
+	if err != nil {
+		return err
+	}
+	err = os.Remove(filepath.Join(dir, filepath.FromSlash(rel)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// checkParents returns an error if a parent of the local path rel below dir is a
+// symlink, the other side could make it point anywhere to read or write through it
+func checkParents(dir string, rel string) error {
+	parent := dir
+	for _, part := range strings.Split(filepath.Dir(rel), string(filepath.Separator)) {
+		if part == "." {
+			continue
+		}
+		parent = filepath.Join(parent, part)
+		info, err := os.Lstat(parent)
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		} else if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%s is below the symlink %s", rel, parent)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package filesync
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// The messages of the sync channel between devssh sync and 'devssh agent sync'
+const (
+	// MessageInit sends the ignore patterns to the agent
+	MessageInit = "init"
+	// MessageIndex answers init with the entries and the root id of the remote directory,
+	// its paths are the files too large to sync
+	MessageIndex = "index"
+	// MessageGet asks the agent for changes with the entries of paths
+	MessageGet = "get"
+	// MessageChange carries an entry and its content, without entry it was removed. A
+	// change of devssh sync has the sum of the remote entry it replaces as base.
+	MessageChange = "change"
+	// MessageApplied confirms a change of devssh sync
+	MessageApplied = "applied"
+	// MessageConflict answers a change whose base isn't the entry of the agent anymore,
+	// it carries the current entry and its content instead
+	MessageConflict = "conflict"
+	// MessageLarge tells devssh sync that the file at the path became too large to sync
+	MessageLarge = "large"
+	// MessageError tells the other side that a change couldn't be applied
+	MessageError = "error"
+)
+
+type Message struct {
+	Type     string   `json:"type"`
+	Patterns []string `json:"patterns,omitempty"`
+	Entries  []*Entry `json:"entries,omitempty"`
+	Paths    []string `json:"paths,omitempty"`
+	Path     string   `json:"path,omitempty"`
+	Entry    *Entry   `json:"entry,omitempty"`
+	Base     string   `json:"base,omitempty"`
+	Root     string   `json:"root,omitempty"`
+	Data     []byte   `json:"data,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// Conn sends and receives messages as json lines, Send may be called concurrently
+type Conn struct {
+	m       sync.Mutex
+	encoder *json.Encoder
+	decoder *json.Decoder
+}
+
+func NewConn(reader io.Reader, writer io.Writer) *Conn {
+	return &Conn{
+		encoder: json.NewEncoder(writer),
+		decoder: json.NewDecoder(reader),
+	}
+}
+
+func (c *Conn) Send(message *Message) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.encoder.Encode(message)
+}
+
+func (c *Conn) Receive() (*Message, error) {
+	message := &Message{}
+	err := c.decoder.Decode(message)
+	if err != nil {
+		return nil, err
+	}
+	return message, nil
+}
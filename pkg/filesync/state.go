@@ -0,0 +1,146 @@
+package filesync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/2017fighting/devssh/pkg/provider"
+	"github.com/gofrs/flock"
+)
+
+// State is what devssh sync keeps between runs of a local and remote directory pair
+// and what devssh sync status shows
+type State struct {
+	Local     string    `json:"local"`
+	Remote    string    `json:"remote"`
+	Context   string    `json:"context,omitempty"`
+	Namespace string    `json:"namespace"`
+	Service   string    `json:"service"`
+	PID       int       `json:"pid,omitempty"`
+	Started   time.Time `json:"started,omitempty"`
+	Connected bool      `json:"connected,omitempty"`
+	LastSync  time.Time `json:"lastSync,omitempty"`
+	Pushed    int       `json:"pushed"`
+	Pulled    int       `json:"pulled"`
+	Conflicts []string  `json:"conflicts,omitempty"`
+	Error     string    `json:"error,omitempty"`
+
+	// Base holds the sums both sides had after the last sync, a side that differs
+	// from it has changed
+	Base map[string]string `json:"base,omitempty"`
+	// Root is the id of the remote directory Base was synced with
+	Root string `json:"root,omitempty"`
+
+	// Running is set by ListStates
+	Running bool `json:"running,omitempty"`
+
+	path string
+}
+
+// StatePath returns the state file of syncing local with remote in the service
+func StatePath(kubeContext string, namespace string, service string, local string, remote string) (string, error) {
+	syncDir, err := provider.GetSyncDir()
+	if err != nil {
+		return "", err
+	}
+	key := strings.Join([]string{kubeContext, namespace, service, local, remote}, "\x00")
+	hash := sha256.Sum256([]byte(key))
+	return filepath.Join(syncDir, hex.EncodeToString(hash[:8])+".json"), nil
+}
+
+// LoadState reads the state at path, an empty one if it doesn't exist yet
+func LoadState(path string) (*State, error) {
+	state := &State{path: path}
+	raw, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(raw, state)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if state.Base == nil {
+		state.Base = map[string]string{}
+	}
+	return state, nil
+}
+
+// ListStates returns the states of all synced directories
+func ListStates() ([]*State, error) {
+	syncDir, err := provider.GetSyncDir()
+	if err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(syncDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	states := []*State{}
+	for _, path := range paths {
+		state, err := LoadState(path)
+		if err != nil {
+			return nil, err
+		}
+		lock := flock.New(path + ".lock")
+		locked, err := lock.TryLock()
+		if err == nil && locked {
+			_ = lock.Unlock()
+		}
+		state.Running = err == nil && !locked
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Local < states[j].Local
+	})
+	return states, nil
+}
+
+// Lock keeps other devssh sync processes from syncing the same directories
+func (s *State) Lock() (*flock.Flock, error) {
+	err := os.MkdirAll(filepath.Dir(s.path), 0o700)
+	if err != nil {
+		return nil, err
+	}
+	lock := flock.New(s.path + ".lock")
+	locked, err := lock.TryLock()
+	if err != nil {
+		return nil, err
+	} else if !locked {
+		return nil, fmt.Errorf("%s is already synced with %s by another devssh sync", s.Local, s.Remote)
+	}
+	return lock, nil
+}
+
+// Save writes the state, it is renamed into place so devssh sync status never reads
+// half of it
+func (s *State) Save() error {
+	raw, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	temp := s.path + ".tmp"
+	err = os.WriteFile(temp, raw, 0o600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(temp, s.path)
+}
+
+func (s *State) setConflict(path string, conflict bool) {
+	index, found := slices.BinarySearch(s.Conflicts, path)
+	if conflict && !found {
+		s.Conflicts = slices.Insert(s.Conflicts, index, path)
+	} else if !conflict && found {
+		s.Conflicts = slices.Delete(s.Conflicts, index, index+1)
+	}
+}
@@ -0,0 +1,455 @@
+package filesync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/2017fighting/devssh/pkg/ignore"
+	"github.com/loft-sh/log"
+)
+
+// The sides --prefer resolves conflicts with
+const (
+	PreferLocal  = "local"
+	PreferRemote = "remote"
+)
+
+// maxLocalDeletes is how many local files a sync deletes at once without --prefer remote,
+// more likely means the directory in the container was replaced
+const maxLocalDeletes = 100
+
+// saveInterval is how often the state is saved while changes are synced
+const saveInterval = 2 * time.Second
+
+// Syncer syncs a local directory with the one of the 'devssh agent sync' it talks to.
+// A side changed a path if its entry differs from the base of the last sync, paths
+// both sides changed are conflicts and stay untouched unless Prefer is set.
+type Syncer struct {
+	Local  string
+	Prefer string
+	State  *State
+	Log    log.Logger
+
+	matcher *ignore.Matcher
+	// remote holds the sums of the remote entries
+	remote map[string]string
+	// gets are the paths to ask the agent for
+	gets []string
+	// pushes are the paths of changes the agent hasn't answered yet and the remote sums
+	// they are based on
+	pushes map[string]string
+	// remoteLarge are the paths of remote files too large to sync, they aren't in remote
+	remoteLarge map[string]bool
+	// warned are the paths that were skipped as too large already
+	warned map[string]bool
+	saved  time.Time
+}
+
+// Run syncs the directories over the connection to the agent until ctx is done or
+// the connection fails
+func (s *Syncer) Run(ctx context.Context, reader io.Reader, writer io.Writer) error {
+	matcher, err := ignore.LoadPatterns(s.Local)
+	if err != nil {
+		return err
+	}
+	s.matcher = matcher
+
+	// the changes the last connection didn't get an answer for may not be applied
+	for path, base := range s.pushes {
+		s.setBase(path, base)
+	}
+	s.pushes = map[string]string{}
+
+	conn := NewConn(reader, writer)
+	err = conn.Send(&Message{Type: MessageInit, Patterns: matcher.Patterns()})
+	if err != nil {
+		return err
+	}
+	index, err := conn.Receive()
+	if err != nil {
+		return fmt.Errorf("read remote index: %w", err)
+	} else if index.Type == MessageError {
+		return fmt.Errorf("agent: %s", index.Error)
+	} else if index.Type != MessageIndex {
+		return fmt.Errorf("unexpected message %s", index.Type)
+	}
+	s.remote = map[string]string{}
+	for _, entry := range index.Entries {
+		if !skip(entry.Path, matcher) {
+			s.remote[entry.Path] = entry.Sum()
+		}
+	}
+	s.remoteLarge, s.warned = map[string]bool{}, map[string]bool{}
+	for _, path := range index.Paths {
+		s.remoteLarge[path] = true
+	}
+	// the base only applies to the directory it was synced with, a new or emptied one is
+	// synced like the first time instead of deleting the local files
+	if len(s.State.Base) > 0 && (index.Root != s.State.Root || len(s.remote) == 0) {
+		s.Log.Warnf("%s in the container is new or empty, syncing both sides like the first time", s.State.Remote)
+		s.State.Base = map[string]string{}
+		s.State.Conflicts = nil
+	}
+	s.State.Root = index.Root
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	localChanges := make(chan []string)
+	watchErr := make(chan error, 1)
+	go func() {
+		watchErr <- Watch(ctx, s.Local, matcher, func(paths []string) {
+			select {
+			case localChanges <- paths:
+			case <-ctx.Done():
+			}
+		})
+	}()
+
+	// the initial sync covers the changes of both sides while they weren't connected
+	local, large, err := Scan(s.Local, matcher)
+	if err != nil {
+		return err
+	}
+	paths := large
+	for _, entries := range []map[string]string{s.remote, s.State.Base} {
+		for path := range entries {
+			paths = append(paths, path)
+		}
+	}
+	for path := range local {
+		paths = append(paths, path)
+	}
+	for path := range s.remoteLarge {
+		paths = append(paths, path)
+	}
+	err = s.syncPaths(conn, paths, nil)
+	if err != nil {
+		return err
+	}
+	s.State.Connected = true
+	s.State.Error = ""
+	s.save()
+	defer s.save()
+	s.Log.Donef("Synced %s, watching for changes", s.Local)
+
+	messages := make(chan *Message, 64)
+	receiveErr := make(chan error, 1)
+	go func() {
+		for {
+			message, err := conn.Receive()
+			if err != nil {
+				receiveErr <- err
+				return
+			}
+			select {
+			case messages <- message:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-receiveErr:
+			return fmt.Errorf("read from agent: %w", err)
+		case err := <-watchErr:
+			return fmt.Errorf("watch %s: %w", s.Local, err)
+		case paths := <-localChanges:
+			err = s.syncPaths(conn, s.expand(paths), nil)
+		case message := <-messages:
+			switch message.Type {
+			case MessageChange:
+				err = s.remoteChange(conn, message)
+			case MessageApplied:
+				s.answered(message)
+			case MessageConflict:
+				err = s.pushConflict(conn, message)
+			case MessageLarge:
+				s.remoteLarge[message.Path] = true
+				s.warnLarge(message.Path)
+			case MessageError:
+				s.Log.Warnf("Error syncing %s in the container: %s", message.Path, message.Error)
+				s.pushFailed(message)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if time.Since(s.saved) >= saveInterval {
+			s.save()
+		}
+	}
+}
+
+func (s *Syncer) remoteChange(conn *Conn, message *Message) error {
+	if skip(message.Path, s.matcher) {
+		return nil
+	}
+	// the agent answers a push itself, with its entry if it didn't apply the push
+	if _, ok := s.pushes[message.Path]; ok {
+		return nil
+	}
+	// a change comes with the data, so the file isn't too large anymore
+	delete(s.remoteLarge, message.Path)
+
+	// the entries of a removed directory are gone as well
+	if message.Entry == nil && s.remote[message.Path] == "dir" {
+		for path := range s.remote {
+			if strings.HasPrefix(path, message.Path+"/") {
+				delete(s.remote, path)
+			}
+		}
+	}
+	s.setRemote(message.Path, message.Entry.Sum())
+	return s.syncPaths(conn, s.expand([]string{message.Path}), message)
+}
+
+// answered forgets the push the message answers, unless the path was pushed again
+func (s *Syncer) answered(message *Message) {
+	if base, ok := s.pushes[message.Path]; ok && base == message.Base {
+		delete(s.pushes, message.Path)
+	}
+}
+
+// pushConflict syncs a path again whose push the agent didn't apply because its entry
+// changed in the meantime, the base is the entry the push expected
+func (s *Syncer) pushConflict(conn *Conn, message *Message) error {
+	s.answered(message)
+	s.setBase(message.Path, message.Base)
+	s.setRemote(message.Path, message.Entry.Sum())
+	return s.syncPaths(conn, []string{message.Path}, message)
+}
+
+// pushFailed restores the sums a failed push was based on, the agent kept its entry
+func (s *Syncer) pushFailed(message *Message) {
+	if _, ok := s.pushes[message.Path]; !ok {
+		return
+	}
+	s.answered(message)
+	s.setBase(message.Path, message.Base)
+	s.setRemote(message.Path, message.Base)
+}
+
+// expand adds the entries of the last sync below directories that were removed
+func (s *Syncer) expand(paths []string) []string {
+	expanded := paths
+	for _, path := range paths {
+		if s.State.Base[path] != "dir" {
+			continue
+		}
+		for base := range s.State.Base {
+			if strings.HasPrefix(base, path+"/") {
+				expanded = append(expanded, base)
+			}
+		}
+	}
+	return expanded
+}
+
+// localDeletes counts the paths whose local entries syncing them would delete
+func (s *Syncer) localDeletes(paths []string) int {
+	count := 0
+	for _, path := range paths {
+		b := s.State.Base[path]
+		if b == "" || s.remote[path] != "" || s.remoteLarge[path] {
+			continue
+		}
+		local, _, err := Read(s.Local, path)
+		if err == nil && decide(local.Sum(), "", b, s.Prefer) == actionPull {
+			count++
+		}
+	}
+	return count
+}
+
+type action int
+
+const (
+	actionNone action = iota
+	actionPush
+	actionPull
+	actionConflict
+)
+
+// decide returns how to sync a path with the local sum l and the remote sum r, b is
+// the sum both had after the last sync. A side that differs from b has changed.
+func decide(l string, r string, b string, prefer string) action {
+	switch {
+	case l == r:
+		return actionNone
+	case r == b:
+		return actionPush
+	case l == b:
+		return actionPull
+	case prefer == PreferLocal:
+		return actionPush
+	case prefer == PreferRemote:
+		return actionPull
+	default:
+		return actionConflict
+	}
+}
+
+// syncPaths syncs the paths, change is the remote change that has the data to pull.
+// Directories are removed after their entries.
+func (s *Syncer) syncPaths(conn *Conn, paths []string, change *Message) error {
+	sort.Strings(paths)
+	paths = slices.Compact(paths)
+	if s.Prefer != PreferRemote {
+		if deletes := s.localDeletes(paths); deletes > maxLocalDeletes {
+			return fmt.Errorf("the container removed %d files, sync with --prefer remote to delete them locally as well", deletes)
+		}
+	}
+	removedDirs := []string{}
+	for _, path := range paths {
+		removedDir, err := s.syncPath(conn, path, change, true)
+		if err != nil {
+			return err
+		} else if removedDir {
+			removedDirs = append(removedDirs, path)
+		}
+	}
+	for i := len(removedDirs) - 1; i >= 0; i-- {
+		_, err := s.syncPath(conn, removedDirs[i], change, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(s.gets) > 0 {
+		err := conn.Send(&Message{Type: MessageGet, Paths: s.gets})
+		if err != nil {
+			return err
+		}
+		s.gets = nil
+	}
+	return nil
+}
+
+// syncPath syncs one path, with deferDirs it only reports whether a directory would
+// be removed
+func (s *Syncer) syncPath(conn *Conn, path string, change *Message, deferDirs bool) (bool, error) {
+	if s.remoteLarge[path] {
+		s.warnLarge(path)
+		return false, nil
+	}
+	local, data, err := Read(s.Local, path)
+	if errors.Is(err, ErrTooLarge) {
+		s.warnLarge(path)
+		return false, nil
+	} else if err != nil {
+		s.Log.Warnf("Error reading %s: %v", path, err)
+		return false, nil
+	}
+	l, r, b := local.Sum(), s.remote[path], s.State.Base[path]
+	action := decide(l, r, b, s.Prefer)
+	switch action {
+	case actionNone:
+		s.synced(path, l)
+		return false, nil
+	case actionConflict:
+		if !slices.Contains(s.State.Conflicts, path) {
+			s.Log.Warnf("Conflict: %s changed on both sides since the last sync, leaving it untouched", path)
+		}
+		s.State.setConflict(path, true)
+		return false, nil
+	}
+	push, pull := action == actionPush, action == actionPull
+	if deferDirs && ((push && l == "" && r == "dir") || (pull && r == "" && l == "dir")) {
+		return true, nil
+	}
+
+	if push {
+		err = conn.Send(&Message{Type: MessageChange, Path: path, Entry: local, Data: data, Base: r})
+		if err != nil {
+			return false, err
+		}
+		s.pushes[path] = r
+		if l == "" {
+			s.Log.Infof("Deleted %s in the container", path)
+		} else {
+			s.Log.Infof("Uploaded %s", path)
+		}
+		s.setRemote(path, l)
+		s.synced(path, l)
+		s.State.Pushed++
+		return false, nil
+	}
+
+	switch {
+	case r == "":
+		err = Remove(s.Local, path)
+		if err == nil {
+			s.Log.Infof("Deleted %s", path)
+		}
+	case change != nil && change.Path == path && change.Entry.Sum() == r:
+		err = Apply(s.Local, change.Entry, change.Data)
+		if err == nil {
+			s.Log.Infof("Downloaded %s", path)
+		}
+	case r == "dir":
+		err = Apply(s.Local, &Entry{Path: path, Dir: true}, nil)
+	default:
+		// the data comes with the change the agent answers with
+		s.gets = append(s.gets, path)
+		return false, nil
+	}
+	if err != nil {
+		s.Log.Warnf("Error syncing %s: %v", path, err)
+		return false, nil
+	}
+	s.synced(path, r)
+	s.State.Pulled++
+	return false, nil
+}
+
+func (s *Syncer) setRemote(path string, sum string) {
+	if sum == "" {
+		delete(s.remote, path)
+	} else {
+		s.remote[path] = sum
+	}
+}
+
+func (s *Syncer) setBase(path string, sum string) {
+	if sum == "" {
+		delete(s.State.Base, path)
+	} else {
+		s.State.Base[path] = sum
+	}
+}
+
+// synced records that both sides have sum at path
+func (s *Syncer) synced(path string, sum string) {
+	if s.State.Base[path] == sum && !slices.Contains(s.State.Conflicts, path) {
+		return
+	}
+	s.setBase(path, sum)
+	s.State.setConflict(path, false)
+	s.State.LastSync = time.Now()
+}
+
+// warnLarge warns once that the file at path is skipped
+func (s *Syncer) warnLarge(path string) {
+	if !s.warned[path] {
+		s.Log.Warnf("Skip %s, files larger than %d MiB aren't synced", path, maxFileSize>>20)
+		s.warned[path] = true
+	}
+}
+
+func (s *Syncer) save() {
+	s.saved = time.Now()
+	err := s.State.Save()
+	if err != nil {
+		s.Log.Debugf("Error saving the sync state: %v", err)
+	}
+}
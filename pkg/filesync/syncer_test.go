@@ -0,0 +1,185 @@
+package filesync
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/loft-sh/log"
+)
+
+func fileSum(data string) string {
+	hash := sha256.Sum256([]byte(data))
+	return "file:" + hex.EncodeToString(hash[:])
+}
+
+func TestDecide(t *testing.T) {
+	a, b, c := fileSum("a"), fileSum("b"), fileSum("c")
+	tests := []struct {
+		name    string
+		local   string
+		remote  string
+		base    string
+		prefer  string
+		expects action
+	}{
+		{name: "unchanged", local: a, remote: a, base: a, expects: actionNone},
+		{name: "created equally on both sides", local: a, remote: a, expects: actionNone},
+		{name: "deleted on both sides", base: a, expects: actionNone},
+		{name: "changed locally", local: b, remote: a, base: a, expects: actionPush},
+		{name: "created locally", local: a, expects: actionPush},
+		{name: "deleted locally", remote: a, base: a, expects: actionPush},
+		{name: "changed remotely", local: a, remote: b, base: a, expects: actionPull},
+		{name: "created remotely", remote: a, expects: actionPull},
+		{name: "deleted remotely", local: a, base: a, expects: actionPull},
+		{name: "changed on both sides", local: b, remote: c, base: a, expects: actionConflict},
+		{name: "created differently on both sides", local: a, remote: b, expects: actionConflict},
+		{name: "deleted locally and changed remotely", remote: b, base: a, expects: actionConflict},
+		{name: "changed locally and deleted remotely", local: b, base: a, expects: actionConflict},
+		{name: "file replaced by a directory remotely", local: a, remote: "dir", base: a, expects: actionPull},
+		{name: "conflict preferring local", local: b, remote: c, base: a, prefer: PreferLocal, expects: actionPush},
+		{name: "conflict preferring remote", local: b, remote: c, base: a, prefer: PreferRemote, expects: actionPull},
+		{name: "prefer doesn't override a one sided change", local: a, remote: b, base: a, prefer: PreferLocal, expects: actionPull},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := decide(test.local, test.remote, test.base, test.prefer); got != test.expects {
+				t.Errorf("decide(%q, %q, %q, %q) = %d, expected %d", test.local, test.remote, test.base, test.prefer, got, test.expects)
+			}
+		})
+	}
+}
+
+func TestSyncPaths(t *testing.T) {
+	tests := []struct {
+		name   string
+		local  string
+		remote string
+		base   string
+		prefer string
+
+		// sent is the type of the message sent to the agent, empty for none
+		sent     string
+		keeps    bool
+		conflict bool
+	}{
+		{name: "pushes a local change", local: "new", remote: fileSum("old"), base: fileSum("old"), sent: MessageChange, keeps: true},
+		{name: "gets a remote change", local: "old", remote: fileSum("new"), base: fileSum("old"), sent: MessageGet, keeps: true},
+		{name: "deletes a remote deletion", local: "old", base: fileSum("old")},
+		{name: "leaves a conflict untouched", local: "a", remote: fileSum("b"), base: fileSum("old"), keeps: true, conflict: true},
+		{name: "pushes a conflict preferring local", local: "a", remote: fileSum("b"), base: fileSum("old"), prefer: PreferLocal, sent: MessageChange, keeps: true},
+		{name: "gets a conflict preferring remote", local: "a", remote: fileSum("b"), base: fileSum("old"), prefer: PreferRemote, sent: MessageGet, keeps: true},
+		{name: "records equal sides", local: "a", remote: fileSum("a"), keeps: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			err := os.WriteFile(filepath.Join(dir, "file"), []byte(test.local), 0o644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			syncer := newTestSyncer(dir, test.prefer)
+			if test.remote != "" {
+				syncer.remote["file"] = test.remote
+			}
+			if test.base != "" {
+				syncer.State.Base["file"] = test.base
+			}
+
+			out := &bytes.Buffer{}
+			conn := NewConn(out, out)
+			err = syncer.syncPaths(conn, []string{"file"}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sent := ""
+			if out.Len() > 0 {
+				message, err := conn.Receive()
+				if err != nil {
+					t.Fatal(err)
+				}
+				sent = message.Type
+				if message.Type == MessageChange && message.Base != test.remote {
+					t.Errorf("the change is based on %q, expected %q", message.Base, test.remote)
+				}
+			}
+			if sent != test.sent {
+				t.Errorf("sent %q, expected %q", sent, test.sent)
+			}
+			if _, err := os.Lstat(filepath.Join(dir, "file")); (err == nil) != test.keeps {
+				t.Errorf("the local file exists: %v, expected %v", err == nil, test.keeps)
+			}
+			if conflict := len(syncer.State.Conflicts) > 0; conflict != test.conflict {
+				t.Errorf("conflict %v, expected %v", conflict, test.conflict)
+			}
+		})
+	}
+}
+
+func TestSyncPathsLimitsLocalDeletes(t *testing.T) {
+	for _, prefer := range []string{"", PreferRemote} {
+		dir := t.TempDir()
+		syncer := newTestSyncer(dir, prefer)
+		paths := []string{}
+		for i := 0; i <= maxLocalDeletes; i++ {
+			path := fmt.Sprintf("file%d", i)
+			err := os.WriteFile(filepath.Join(dir, path), []byte("old"), 0o644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			syncer.State.Base[path] = fileSum("old")
+			paths = append(paths, path)
+		}
+
+		out := &bytes.Buffer{}
+		err := syncer.syncPaths(NewConn(out, out), paths, nil)
+		entries, _ := os.ReadDir(dir)
+		if prefer == "" && (err == nil || len(entries) != len(paths)) {
+			t.Errorf("deleted %d local files without --prefer remote", len(paths)-len(entries))
+		} else if prefer == PreferRemote && (err != nil || len(entries) != 0) {
+			t.Errorf("kept %d local files with --prefer remote: %v", len(entries), err)
+		}
+	}
+}
+
+func TestSyncPathsSkipsLargeRemoteFiles(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "file"), []byte("old"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	syncer := newTestSyncer(dir, PreferRemote)
+	syncer.State.Base["file"] = fileSum("old")
+	syncer.remoteLarge["file"] = true
+
+	out := &bytes.Buffer{}
+	err = syncer.syncPaths(NewConn(out, out), []string{"file"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "file")); err != nil {
+		t.Errorf("deleted the local file of a remote file too large to sync")
+	}
+	if out.Len() > 0 {
+		t.Errorf("sent %q for a remote file too large to sync", out.String())
+	}
+}
+
+func newTestSyncer(dir string, prefer string) *Syncer {
+	return &Syncer{
+		Local:  dir,
+		Prefer: prefer,
+		State:  &State{Base: map[string]string{}},
+		Log:    log.Discard,
+		remote: map[string]string{},
+		pushes: map[string]string{},
+
+		remoteLarge: map[string]bool{},
+		warned:      map[string]bool{},
+	}
+}
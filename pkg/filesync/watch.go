@@ -0,0 +1,110 @@
+package filesync
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/2017fighting/devssh/pkg/ignore"
+	"github.com/fsnotify/fsnotify"
+)
+
+// debounce is how long changes are collected after the first one before they are
+// synced, editors and compilers write files in several steps
+const debounce = 200 * time.Millisecond
+
+// Watch calls changed with the paths below dir that changed, until ctx is done. Created
+// directories are watched as well and the entries they already have are reported.
+func Watch(ctx context.Context, dir string, matcher *ignore.Matcher, changed func(paths []string)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	pending := map[string]bool{}
+	err = watchDir(watcher, dir, dir, matcher, nil)
+	if err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			// events were lost on overflows, the caller has to scan again
+			return err
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			rel, err := filepath.Rel(dir, event.Name)
+			if err != nil || rel == "." {
+				continue
+			}
+			rel = filepath.ToSlash(rel)
+			if skip(rel, matcher) {
+				continue
+			}
+
+			if len(pending) == 0 {
+				timer.Reset(debounce)
+			}
+			pending[rel] = true
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Lstat(event.Name); err == nil && info.IsDir() {
+					_ = watchDir(watcher, dir, event.Name, matcher, pending)
+				}
+			}
+		case <-timer.C:
+			paths := make([]string, 0, len(pending))
+			for path := range pending {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+			pending = map[string]bool{}
+			changed(paths)
+		}
+	}
+}
+
+// watchDir watches the directories below start that aren't ignored and adds their
+// entries to pending
+func watchDir(watcher *fsnotify.Watcher, dir string, start string, matcher *ignore.Matcher, pending map[string]bool) error {
+	return filepath.WalkDir(start, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// the directory was removed again
+			return nil
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel != "." {
+			if skip(rel, matcher) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if pending != nil {
+				pending[rel] = true
+			}
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		return watcher.Add(file)
+	})
+}
@@ -0,0 +1,240 @@
+package ignore
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/moby/patternmatcher"
+)
+
+// FileName holds patterns of files to leave out in the dockerignore format,
+// without it the .gitignore files of the git repository are used. .git is left out
+// unless a pattern like !.git includes it again.
+const FileName = ".devsshignore"
+
+// Matcher decides which files of a directory are left out when it is copied
+type Matcher struct {
+	patterns []string
+	matcher  *patternmatcher.PatternMatcher
+	// ignored are the paths git ignores, directories end with a slash
+	ignored map[string]bool
+}
+
+// New returns a matcher of patterns in the dockerignore format
+func New(patterns []string) (*Matcher, error) {
+	matcher, err := patternmatcher.New(patterns)
+	if err != nil {
+		return nil, err
+	}
+	return &Matcher{patterns: patterns, matcher: matcher}, nil
+}
+
+// Load reads the .devsshignore of dir, or asks git which files are ignored if dir is
+// in a git repository. Nothing is ignored otherwise.
+func Load(dir string) (*Matcher, error) {
+	matcher, err := loadIgnoreFile(dir)
+	if matcher != nil || err != nil {
+		return matcher, err
+	}
+
+	// --directory lists ignored directories instead of their files
+	out, err := exec.Command("git", "-C", dir, "ls-files", "--others", "--ignored", "--exclude-standard", "--directory", "-z").Output()
+	if err != nil {
+		return &Matcher{}, nil
+	}
+	ignored := map[string]bool{".git/": true}
+	for _, path := range bytes.Split(out, []byte{0}) {
+		if len(path) > 0 {
+			ignored[string(path)] = true
+		}
+	}
+	return &Matcher{ignored: ignored}, nil
+}
+
+// LoadPatterns reads the .devsshignore of dir, or else converts the .gitignore files in
+// dir and its subdirectories. Unlike Load the matcher only has patterns, so they can
+// be sent to the container and match files that don't exist locally.
+func LoadPatterns(dir string) (*Matcher, error) {
+	matcher, err := loadIgnoreFile(dir)
+	if matcher != nil || err != nil {
+		return matcher, err
+	}
+
+	matcher, err = New([]string{".git"})
+	if err != nil {
+		return nil, err
+	}
+	err = filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			rel = ""
+		} else if matcher.Ignored(rel, true) {
+			return filepath.SkipDir
+		}
+
+		// the patterns of a directory apply before its entries are visited
+		raw, err := os.ReadFile(filepath.Join(file, ".gitignore"))
+		if err != nil {
+			return nil
+		}
+		patterns := matcher.patterns
+		for _, line := range parseLines(raw) {
+			patterns = append(patterns, gitPattern(rel, line))
+		}
+		matcher, err = New(patterns)
+		if err != nil {
+			return fmt.Errorf("parse %s: %w", path.Join(rel, ".gitignore"), err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return matcher, nil
+}
+
+// loadIgnoreFile returns the matcher of the .devsshignore of dir, nil if there is none
+func loadIgnoreFile(dir string) (*Matcher, error) {
+	raw, err := os.ReadFile(filepath.Join(dir, FileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	matcher, err := New(append([]string{".git"}, parseLines(raw)...))
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", FileName, err)
+	}
+	return matcher, nil
+}
+
+func parseLines(raw []byte) []string {
+	lines := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// gitPattern converts a line of the .gitignore in dir to the dockerignore format.
+// Patterns only for directories also match files of that name.
+func gitPattern(dir string, line string) string {
+	negate := strings.HasPrefix(line, "!")
+	line = strings.TrimSuffix(strings.TrimPrefix(line, "!"), "/")
+
+	// patterns without a slash match at any depth, the others relative to the .gitignore
+	if strings.Contains(line, "/") {
+		line = strings.TrimPrefix(line, "/")
+	} else {
+		line = "**/" + line
+	}
+	if dir != "" {
+		line = dir + "/" + line
+	}
+	if negate {
+		return "!" + line
+	}
+	return line
+}
+
+// Patterns returns the patterns of the matcher in the dockerignore format, there are
+// none for the paths git ignores
+func (m *Matcher) Patterns() []string {
+	return m.patterns
+}
+
+// Ignored reports whether the file at the slash separated path relative to the directory is left out
+func (m *Matcher) Ignored(path string, isDir bool) bool {
+	if m.matcher != nil {
+		ignored, _ := m.matcher.MatchesOrParentMatches(path)
+		return ignored
+	}
+	if isDir {
+		path += "/"
+	}
+	return m.ignored[path]
+}
+
+// WriteTar writes the files of dir that aren't ignored to writer, the paths in the
+// archive are relative to dir
+func WriteTar(writer io.Writer, dir string, matcher *Matcher) error {
+	tarWriter := tar.NewWriter(writer)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if matcher.Ignored(rel, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, err = os.Readlink(path)
+			if err != nil {
+				return err
+			}
+		} else if !info.Mode().IsRegular() && !info.IsDir() {
+			// sockets, devices and pipes can't be copied
+			return nil
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = rel
+		header.Uid, header.Gid, header.Uname, header.Gname = 0, 0, "", ""
+		err = tarWriter.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(tarWriter, file)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tarWriter.Close()
+}
@@ -0,0 +1,71 @@
+package ignore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGitPattern(t *testing.T) {
+	tests := []struct {
+		dir     string
+		line    string
+		expects string
+	}{
+		{line: "*.log", expects: "**/*.log"},
+		{line: "build/", expects: "**/build"},
+		{line: "/build", expects: "build"},
+		{line: "docs/*.html", expects: "docs/*.html"},
+		{line: "!keep.log", expects: "!**/keep.log"},
+		{line: "!/dist/", expects: "!dist"},
+		{dir: "web", line: "node_modules/", expects: "web/**/node_modules"},
+		{dir: "web", line: "/out", expects: "web/out"},
+		{dir: "web/app", line: "!src/gen.go", expects: "!web/app/src/gen.go"},
+	}
+	for _, test := range tests {
+		if got := gitPattern(test.dir, test.line); got != test.expects {
+			t.Errorf("gitPattern(%q, %q) = %q, expected %q", test.dir, test.line, got, test.expects)
+		}
+	}
+}
+
+func TestLoadPatterns(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		".gitignore":     "*.log\n!keep.log\n# comment\n/dist\n",
+		"web/.gitignore": "/out\n",
+	}
+	for name, content := range files {
+		err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755)
+		if err == nil {
+			err = os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	matcher, err := LoadPatterns(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path    string
+		ignored bool
+	}{
+		{path: ".git/config", ignored: true},
+		{path: "debug.log", ignored: true},
+		{path: "web/debug.log", ignored: true},
+		{path: "keep.log"},
+		{path: "dist/app", ignored: true},
+		{path: "web/dist/app"},
+		{path: "web/out/index.html", ignored: true},
+		{path: "out/index.html"},
+		{path: "main.go"},
+	}
+	for _, test := range tests {
+		if got := matcher.Ignored(test.path, false); got != test.ignored {
+			t.Errorf("Ignored(%q) = %v, expected %v", test.path, got, test.ignored)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package kubernetes
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ListContexts returns the names of the contexts in the kubeconfig
+func ListContexts() ([]string, error) {
+	rawConfig, err := clientConfig().RawConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for name := range rawConfig.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// ListNamespaces returns the names of all namespaces
+func ListNamespaces(ctx context.Context) ([]string, error) {
+	_, clientset := getK8sClient()
+	namespaces, err := clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, namespace := range namespaces.Items {
+		names = append(names, namespace.Name)
+	}
+	return names, nil
+}
+
+// ListServices returns the names of the services in the namespace that select pods
+func ListServices(ctx context.Context, namespace string) ([]string, error) {
+	_, clientset := getK8sClient()
+	services, err := clientset.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, svc := range services.Items {
+		if len(svc.Spec.Selector) > 0 {
+			names = append(names, svc.Name)
+		}
+	}
+	return names, nil
+}
+
+// ListContainers returns the containers of the pod devssh would connect to
+func ListContainers(ctx context.Context, namespace string, service string) ([]string, error) {
+	_, clientset := getK8sClient()
+	pod, err := findPodByService(ctx, clientset, namespace, service)
+	if err != nil {
+		return nil, err
+	} else if pod == nil {
+		return nil, fmt.Errorf("no pod found for svc %s", service)
+	}
+
+	names := []string{}
+	for _, container := range pod.Spec.Containers {
+		names = append(names, container.Name)
+	}
+	return names, nil
+}
+
+// ListUsers returns the users from /etc/passwd of the container that have a login shell
+func ListUsers(ctx context.Context, namespace string, service string, container string) ([]string, error) {
+	_, clientset := getK8sClient()
+	pod, err := findPodByService(ctx, clientset, namespace, service)
+	if err != nil {
+		return nil, err
+	} else if pod == nil {
+		return nil, fmt.Errorf("no pod found for svc %s", service)
+	}
+
+	stdout := &bytes.Buffer{}
+	err = Exec(ctx, namespace, pod.Name, container, []string{"cat", "/etc/passwd"}, nil, stdout, io.Discard)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		// name:password:uid:gid:comment:home:shell
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) != 7 {
+			continue
+		}
+		shell := path.Base(fields[6])
+		if shell == "nologin" || shell == "false" || shell == "sync" {
+			continue
+		}
+		names = append(names, fields[0])
+	}
+	return names, nil
+}
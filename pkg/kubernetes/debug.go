@@ -0,0 +1,101 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/loft-sh/log"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const debugContainerPrefix = "devssh-debug-"
+
+// AttachDebugContainer adds an ephemeral container running image to the pod and
+// waits until it is running. The container shares the process namespace of the
+// target container, which defaults to the first container of the pod. A running
+// debug container with the same image and target is reused instead of adding a
+// new one, because ephemeral containers can't be removed from a pod.
+func AttachDebugContainer(ctx context.Context, namespace string, podName string, target string, image string, log log.Logger) (string, error) {
+	_, clientset := getK8sClient()
+	pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("get pod %s: %w", podName, err)
+	}
+	if target == "" {
+		target = pod.Spec.Containers[0].Name
+	}
+
+	name := findDebugContainer(pod, target, image)
+	if name == "" {
+		name = debugContainerPrefix + utilrand.String(5)
+		log.Infof("Attach debug container %s (%s) to %s/%s", name, image, podName, target)
+		pod.Spec.EphemeralContainers = append(pod.Spec.EphemeralContainers, corev1.EphemeralContainer{
+			EphemeralContainerCommon: corev1.EphemeralContainerCommon{
+				Name:                     name,
+				Image:                    image,
+				ImagePullPolicy:          corev1.PullIfNotPresent,
+				TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+				// keep the default entrypoint alive the same way kubectl debug does
+				Stdin: true,
+				TTY:   true,
+			},
+			TargetContainerName: target,
+		})
+		_, err = clientset.CoreV1().Pods(namespace).UpdateEphemeralContainers(ctx, podName, pod, metav1.UpdateOptions{})
+		if err != nil {
+			return "", fmt.Errorf("add ephemeral container: %w", err)
+		}
+	} else {
+		log.Infof("Reuse debug container %s", name)
+	}
+
+	err = wait.PollUntilContextTimeout(ctx, time.Second, 2*time.Minute, true, func(ctx context.Context) (bool, error) {
+		pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		for _, status := range pod.Status.EphemeralContainerStatuses {
+			if status.Name != name {
+				continue
+			}
+			if status.State.Running != nil {
+				return true, nil
+			} else if status.State.Terminated != nil {
+				return false, fmt.Errorf("debug container %s terminated: %s", name, status.State.Terminated.Reason)
+			} else if status.State.Waiting != nil && isImagePullFailure(status.State.Waiting.Reason) {
+				return false, fmt.Errorf("debug container %s: %s", name, status.State.Waiting.Message)
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("wait for debug container: %w", err)
+	}
+
+	return name, nil
+}
+
+func findDebugContainer(pod *corev1.Pod, target string, image string) string {
+	running := map[string]bool{}
+	for _, status := range pod.Status.EphemeralContainerStatuses {
+		running[status.Name] = status.State.Running != nil
+	}
+	for _, container := range pod.Spec.EphemeralContainers {
+		if !strings.HasPrefix(container.Name, debugContainerPrefix) {
+			continue
+		}
+		if container.Image == image && container.TargetContainerName == target && running[container.Name] {
+			return container.Name
+		}
+	}
+	return ""
+}
+
+func isImagePullFailure(reason string) bool {
+	return reason == "ErrImagePull" || reason == "ImagePullBackOff" || reason == "InvalidImageName"
+}
@@ -4,26 +4,48 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"path/filepath"
 
-	"github.com/2017fighting/devssh/pkg/agent"
 	"github.com/loft-sh/log"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	restclient "k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 	"k8s.io/client-go/tools/remotecommand"
-	"k8s.io/client-go/util/homedir"
 )
 
-func getK8sClient() (*restclient.Config, *kubernetes.Clientset) {
-	kubeconfigPath := filepath.Join(homedir.HomeDir(), ".kube", "config")
+// kubeContext is the context of the kubeconfig to use, the current context if empty
+var kubeContext string
+
+// SetContext selects the kube context for all following k8s api calls
+func SetContext(name string) {
+	kubeContext = name
+}
 
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+// CurrentContext returns the name of the kube context in use
+func CurrentContext() (string, error) {
+	if kubeContext != "" {
+		return kubeContext, nil
+	}
+	rawConfig, err := clientConfig().RawConfig()
+	if err != nil {
+		return "", fmt.Errorf("load kubeconfig: %w", err)
+	}
+	return rawConfig.CurrentContext, nil
+}
+
+func clientConfig() clientcmd.ClientConfig {
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		clientcmd.NewDefaultClientConfigLoadingRules(),
+		&clientcmd.ConfigOverrides{CurrentContext: kubeContext},
+	)
+}
+
+func getK8sClient() (*restclient.Config, *kubernetes.Clientset) {
+	config, err := clientConfig().ClientConfig()
 	if err != nil {
 		panic(fmt.Errorf("build k8s config: %w", err))
 	}
@@ -34,48 +56,51 @@ func getK8sClient() (*restclient.Config, *kubernetes.Clientset) {
 	return config, clientset
 }
 
-func IsSVCRunning(namespace string, service string) error {
+// FindReadyPod returns the name of a ready pod of the service, an empty string if it has none
+func FindReadyPod(ctx context.Context, namespace string, service string) (string, error) {
 	_, clientset := getK8sClient()
-	_, err := clientset.CoreV1().Services(namespace).Get(context.TODO(), service, metav1.GetOptions{})
-	return err
+	pod, err := findPodByService(ctx, clientset, namespace, service)
+	if err != nil || pod == nil || !isPodReady(pod) {
+		return "", err
+	}
+	return pod.Name, nil
 }
 
-func getPodByService(namespace string, service string) string {
-	_, clientset := getK8sClient()
-	svc, err := clientset.CoreV1().Services(namespace).Get(context.TODO(), service, metav1.GetOptions{})
-	if errors.IsNotFound(err) {
-		panic(fmt.Errorf("svc(%v) not found in namespace:%v", service, namespace))
-	} else if statusError, isStatus := err.(*errors.StatusError); isStatus {
-		panic(fmt.Errorf("get svc in k8s: %v", statusError.ErrStatus.Message))
-	} else if err != nil {
-		panic(fmt.Errorf("get svc in k8s: %w", err))
-	}
-	pods, err := clientset.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{
+// findPodByService returns the pod devssh connects to, nil if the service selects no pods
+func findPodByService(ctx context.Context, clientset *kubernetes.Clientset, namespace string, service string) (*corev1.Pod, error) {
+	svc, err := clientset.CoreV1().Services(namespace).Get(ctx, service, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
 		LabelSelector: labels.Set(svc.Spec.Selector).AsSelector().String(),
 	})
 	if err != nil {
-		panic(fmt.Errorf("get pods: %w", err))
+		return nil, err
+	}
+	// prefer ready pods, a restarting or terminating pod can't be connected to
+	for i := range pods.Items {
+		if isPodReady(&pods.Items[i]) {
+			return &pods.Items[i], nil
+		}
 	}
-	for _, pod := range pods.Items {
-		return pod.Name
+	if len(pods.Items) > 0 {
+		return &pods.Items[0], nil
 	}
-	return ""
+	return nil, nil
 }
 
-func Exec(ctx context.Context, namespace string, service string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+// Exec runs command in the container of the pod and waits until it exits, stdin is
+// only attached if it isn't nil
+func Exec(ctx context.Context, namespace string, podName string, container string, command []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
 	config, clientset := getK8sClient()
-	podName := getPodByService(namespace, service)
-	log.Default.Infof("get podName:%v", podName)
 	req := clientset.CoreV1().RESTClient().Post().Resource("pods").Namespace(namespace).Name(podName).SubResource("exec").VersionedParams(
 		&corev1.PodExecOptions{
-			Command: []string{agent.ContainerDevPodHelperLocation, "ssh-server"},
-			// Command: []string{"ls", "/mnt"},
-			// Command: []string{"zsh"},
-			Stdin:  true,
-			Stdout: true,
-			Stderr: true,
-			TTY:    false,
-			// TTY:    true,
+			Container: container,
+			Command:   command,
+			Stdin:     stdin != nil,
+			Stdout:    true,
+			Stderr:    true,
 		}, scheme.ParameterCodec,
 	)
 
@@ -83,20 +108,48 @@ func Exec(ctx context.Context, namespace string, service string, stdin io.Reader
 	if err != nil {
 		return fmt.Errorf("k8s remote exec: %s", err)
 	}
-	// screen := struct {
-	// 	io.Reader
-	// 	io.Writer
-	// }{os.Stdin, os.Stdout}
-
 	if err = exec.StreamWithContext(ctx, remotecommand.StreamOptions{
 		Stdin:  stdin,
 		Stdout: stdout,
-		// Stdin:  screen,
-		// Stdout: screen,
 		Stderr: stderr,
-		Tty:    true,
 	}); err != nil {
 		return fmt.Errorf("k8s exec: %w", err)
 	}
 	return nil
 }
+
+// MinifiedConfig returns a self-contained kubeconfig with only the context in use
+func MinifiedConfig(log log.Logger) ([]byte, error) {
+	rawConfig, err := clientConfig().RawConfig()
+	if err != nil {
+		return nil, fmt.Errorf("load kubeconfig: %w", err)
+	}
+	if kubeContext != "" {
+		rawConfig.CurrentContext = kubeContext
+	}
+
+	err = clientcmdapi.MinifyConfig(&rawConfig)
+	if err != nil {
+		return nil, fmt.Errorf("minify kubeconfig: %w", err)
+	}
+	err = clientcmdapi.FlattenConfig(&rawConfig)
+	if err != nil {
+		return nil, fmt.Errorf("flatten kubeconfig: %w", err)
+	}
+	for name, authInfo := range rawConfig.AuthInfos {
+		if authInfo.Exec != nil {
+			log.Warnf("User %s of the kubeconfig runs %s to authenticate, which has to be installed in the container as well", name, authInfo.Exec.Command)
+		}
+	}
+	return clientcmd.Write(rawConfig)
+}
+
+// GetPodUID returns the uid of the pod, which changes when the pod is recreated
+func GetPodUID(ctx context.Context, namespace string, podName string) (string, error) {
+	_, clientset := getK8sClient()
+	pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("get pod: %w", err)
+	}
+	return string(pod.UID), nil
+}
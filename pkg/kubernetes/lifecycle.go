@@ -0,0 +1,144 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/loft-sh/log"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// GetWorkspaceDeployment returns the deployment backing the service. Deployments created
+// by devssh up are found by their label, others by matching the service selector.
+// It returns nil if the service isn't backed by a deployment, e.g. a bare pod.
+func GetWorkspaceDeployment(ctx context.Context, namespace string, service string) (*appsv1.Deployment, error) {
+	_, clientset := getK8sClient()
+	return getWorkspaceDeployment(ctx, clientset, namespace, service)
+}
+
+func getWorkspaceDeployment(ctx context.Context, clientset *kubernetes.Clientset, namespace string, service string) (*appsv1.Deployment, error) {
+	deployments, err := clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.Set(workspaceLabels(service)).AsSelector().String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list deployments: %w", err)
+	}
+	if len(deployments.Items) > 0 {
+		return &deployments.Items[0], nil
+	}
+
+	svc, err := clientset.CoreV1().Services(namespace).Get(ctx, service, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("get svc: %w", err)
+	}
+	if len(svc.Spec.Selector) == 0 {
+		return nil, nil
+	}
+	selector := labels.Set(svc.Spec.Selector).AsSelector()
+
+	deployments, err = clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list deployments: %w", err)
+	}
+	for i := range deployments.Items {
+		if selector.Matches(labels.Set(deployments.Items[i].Spec.Template.Labels)) {
+			return &deployments.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// ScaleWorkspace sets the replicas of the deployment backing the service
+func ScaleWorkspace(ctx context.Context, namespace string, service string, replicas int32, log log.Logger) error {
+	_, clientset := getK8sClient()
+	deployment, err := getWorkspaceDeployment(ctx, clientset, namespace, service)
+	if err != nil {
+		return err
+	} else if deployment == nil {
+		return fmt.Errorf("svc %s isn't backed by a deployment and can't be scaled", service)
+	}
+
+	scale, err := clientset.AppsV1().Deployments(namespace).GetScale(ctx, deployment.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("get scale of deployment %s: %w", deployment.Name, err)
+	}
+	if scale.Spec.Replicas == replicas {
+		return nil
+	}
+
+	log.Infof("Scale deployment %s/%s to %d", namespace, deployment.Name, replicas)
+	scale.Spec.Replicas = replicas
+	_, err = clientset.AppsV1().Deployments(namespace).UpdateScale(ctx, deployment.Name, scale, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("scale deployment %s: %w", deployment.Name, err)
+	}
+	return nil
+}
+
+// DeleteWorkspace removes the workload and the service created by devssh up and,
+// if deleteVolume is set, the workspace volume as well
+func DeleteWorkspace(ctx context.Context, namespace string, service string, deleteVolume bool, log log.Logger) error {
+	_, clientset := getK8sClient()
+	svc, err := clientset.CoreV1().Services(namespace).Get(ctx, service, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("get svc: %w", err)
+	}
+	if svc.Labels[WorkspaceLabel] != service {
+		return fmt.Errorf("svc %s wasn't created by devssh up, refusing to delete it", service)
+	}
+
+	selector := labels.Set(workspaceLabels(service)).AsSelector().String()
+	deployments, err := clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return fmt.Errorf("list deployments: %w", err)
+	}
+	for _, deployment := range deployments.Items {
+		log.Infof("Delete deployment %s/%s", namespace, deployment.Name)
+		err = clientset.AppsV1().Deployments(namespace).Delete(ctx, deployment.Name, metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("delete deployment %s: %w", deployment.Name, err)
+		}
+	}
+
+	// bare pods created from a template, pods owned by the deployment are removed with it
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return fmt.Errorf("list pods: %w", err)
+	}
+	for _, pod := range pods.Items {
+		if len(pod.OwnerReferences) > 0 {
+			continue
+		}
+		log.Infof("Delete pod %s/%s", namespace, pod.Name)
+		err = clientset.CoreV1().Pods(namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("delete pod %s: %w", pod.Name, err)
+		}
+	}
+
+	log.Infof("Delete service %s/%s", namespace, service)
+	err = clientset.CoreV1().Services(namespace).Delete(ctx, service, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("delete service %s: %w", service, err)
+	}
+
+	if !deleteVolume {
+		return nil
+	}
+	volumes, err := clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return fmt.Errorf("list volumes: %w", err)
+	}
+	for _, volume := range volumes.Items {
+		log.Infof("Delete volume %s/%s", namespace, volume.Name)
+		err = clientset.CoreV1().PersistentVolumeClaims(namespace).Delete(ctx, volume.Name, metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("delete volume %s: %w", volume.Name, err)
+		}
+	}
+	return nil
+}
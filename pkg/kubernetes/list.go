@@ -0,0 +1,157 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/2017fighting/devssh/pkg/agent"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	DevSSHInstalled    = "yes"
+	DevSSHNotInstalled = "no"
+	DevSSHUnknown      = "unknown"
+)
+
+// devsshCheckTimeout bounds the exec that checks for the devssh binary in a pod
+const devsshCheckTimeout = 5 * time.Second
+
+type WorkspaceSummary struct {
+	Namespace string    `json:"namespace"`
+	Service   string    `json:"service"`
+	Pod       string    `json:"pod,omitempty"`
+	Ready     int       `json:"ready"`
+	Pods      int       `json:"pods"`
+	Created   time.Time `json:"created"`
+	Image     string    `json:"image,omitempty"`
+	DevSSH    string    `json:"devssh"`
+}
+
+type ListOptions struct {
+	// Namespace to list, all namespaces if empty
+	Namespace string
+	// WorkspacesOnly restricts the list to services created by devssh up
+	WorkspacesOnly bool
+	// CheckDevSSH execs into the pods to find out if devssh is installed
+	CheckDevSSH bool
+}
+
+// ListWorkspaces returns the services that can be connected to, that is every service
+// with a selector, together with the pod devssh would connect to
+func ListWorkspaces(ctx context.Context, options ListOptions) ([]WorkspaceSummary, error) {
+	_, clientset := getK8sClient()
+	namespace := options.Namespace
+	if namespace == "" {
+		namespace = metav1.NamespaceAll
+	}
+
+	listOptions := metav1.ListOptions{}
+	if options.WorkspacesOnly {
+		listOptions.LabelSelector = WorkspaceLabel
+	}
+	services, err := clientset.CoreV1().Services(namespace).List(ctx, listOptions)
+	if err != nil {
+		return nil, fmt.Errorf("list services: %w", err)
+	}
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list pods: %w", err)
+	}
+	podsByNamespace := map[string][]*corev1.Pod{}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		podsByNamespace[pod.Namespace] = append(podsByNamespace[pod.Namespace], pod)
+	}
+
+	workspaces := []WorkspaceSummary{}
+	for _, svc := range services.Items {
+		if len(svc.Spec.Selector) == 0 {
+			continue
+		}
+		selector := labels.Set(svc.Spec.Selector).AsSelector()
+		workspace := WorkspaceSummary{
+			Namespace: svc.Namespace,
+			Service:   svc.Name,
+			DevSSH:    DevSSHUnknown,
+		}
+
+		var target *corev1.Pod
+		for _, pod := range podsByNamespace[svc.Namespace] {
+			if !selector.Matches(labels.Set(pod.Labels)) {
+				continue
+			}
+			workspace.Pods++
+			if isPodReady(pod) {
+				workspace.Ready++
+				if target == nil || !isPodReady(target) {
+					target = pod
+				}
+			} else if target == nil {
+				target = pod
+			}
+		}
+		if target != nil {
+			workspace.Pod = target.Name
+			workspace.Created = target.CreationTimestamp.Time
+			workspace.Image = target.Spec.Containers[0].Image
+		}
+		workspaces = append(workspaces, workspace)
+	}
+
+	if options.CheckDevSSH {
+		checkDevSSH(ctx, workspaces)
+	}
+
+	sort.Slice(workspaces, func(i, j int) bool {
+		if workspaces[i].Namespace != workspaces[j].Namespace {
+			return workspaces[i].Namespace < workspaces[j].Namespace
+		}
+		return workspaces[i].Service < workspaces[j].Service
+	})
+	return workspaces, nil
+}
+
+// checkDevSSH runs the devssh binary in every ready pod, a few pods at a time
+func checkDevSSH(ctx context.Context, workspaces []WorkspaceSummary) {
+	wg := sync.WaitGroup{}
+	limit := make(chan struct{}, 8)
+	for i := range workspaces {
+		if workspaces[i].Pod == "" || workspaces[i].Ready == 0 {
+			continue
+		}
+
+		wg.Add(1)
+		go func(workspace *WorkspaceSummary) {
+			defer wg.Done()
+			limit <- struct{}{}
+			defer func() { <-limit }()
+
+			workspace.DevSSH = hasDevSSH(ctx, workspace.Namespace, workspace.Pod)
+		}(&workspaces[i])
+	}
+	wg.Wait()
+}
+
+func hasDevSSH(ctx context.Context, namespace string, podName string) string {
+	ctx, cancel := context.WithTimeout(ctx, devsshCheckTimeout)
+	defer cancel()
+
+	stderr := &strings.Builder{}
+	err := Exec(ctx, namespace, podName, "", []string{agent.ContainerDevPodHelperLocation, "--help"}, nil, io.Discard, stderr)
+	if err == nil {
+		return DevSSHInstalled
+	}
+	message := strings.ToLower(err.Error() + stderr.String())
+	if strings.Contains(message, "no such file") || strings.Contains(message, "not found") {
+		return DevSSHNotInstalled
+	}
+	return DevSSHUnknown
+}
@@ -0,0 +1,192 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// restartWarningThreshold is the restart count from which a container is reported as unstable
+const restartWarningThreshold = 3
+
+type WorkspaceInfo struct {
+	Namespace string `json:"namespace"`
+	Service   string `json:"service"`
+	Found     bool   `json:"found"`
+
+	// Deployment is empty if the service isn't backed by a deployment
+	Deployment string `json:"deployment,omitempty"`
+	Replicas   int32  `json:"replicas"`
+
+	Pods []PodInfo `json:"pods"`
+}
+
+type PodInfo struct {
+	Name       string          `json:"name"`
+	UID        string          `json:"uid"`
+	Phase      string          `json:"phase"`
+	Ready      bool            `json:"ready"`
+	Node       string          `json:"node,omitempty"`
+	Created    time.Time       `json:"created"`
+	Reason     string          `json:"reason,omitempty"`
+	Message    string          `json:"message,omitempty"`
+	Containers []ContainerInfo `json:"containers"`
+}
+
+type ContainerInfo struct {
+	Name     string `json:"name"`
+	Image    string `json:"image"`
+	Ready    bool   `json:"ready"`
+	State    string `json:"state"`
+	Reason   string `json:"reason,omitempty"`
+	Message  string `json:"message,omitempty"`
+	Restarts int32  `json:"restarts"`
+}
+
+// GetWorkspaceInfo collects the state of the pods behind the service
+func GetWorkspaceInfo(ctx context.Context, namespace string, service string) (*WorkspaceInfo, error) {
+	_, clientset := getK8sClient()
+	info := &WorkspaceInfo{Namespace: namespace, Service: service}
+
+	svc, err := clientset.CoreV1().Services(namespace).Get(ctx, service, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return info, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("get svc: %w", err)
+	}
+	info.Found = true
+
+	deployment, err := getWorkspaceDeployment(ctx, clientset, namespace, service)
+	if err != nil {
+		return nil, err
+	} else if deployment != nil {
+		info.Deployment = deployment.Name
+		info.Replicas = 1
+		if deployment.Spec.Replicas != nil {
+			info.Replicas = *deployment.Spec.Replicas
+		}
+	}
+
+	if len(svc.Spec.Selector) == 0 {
+		return info, nil
+	}
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.Set(svc.Spec.Selector).AsSelector().String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list pods: %w", err)
+	}
+	for i := range pods.Items {
+		info.Pods = append(info.Pods, newPodInfo(&pods.Items[i]))
+	}
+
+	return info, nil
+}
+
+func newPodInfo(pod *corev1.Pod) PodInfo {
+	info := PodInfo{
+		Name:    pod.Name,
+		UID:     string(pod.UID),
+		Phase:   string(pod.Status.Phase),
+		Ready:   isPodReady(pod),
+		Node:    pod.Spec.NodeName,
+		Created: pod.CreationTimestamp.Time,
+		Reason:  pod.Status.Reason,
+		Message: pod.Status.Message,
+	}
+	if pod.DeletionTimestamp != nil {
+		info.Reason = "Terminating"
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionFalse {
+			info.Reason = condition.Reason
+			info.Message = condition.Message
+		}
+	}
+
+	images := map[string]string{}
+	for _, container := range pod.Spec.Containers {
+		images[container.Name] = container.Image
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		container := ContainerInfo{
+			Name:     status.Name,
+			Image:    images[status.Name],
+			Ready:    status.Ready,
+			Restarts: status.RestartCount,
+		}
+		switch {
+		case status.State.Running != nil:
+			container.State = "Running"
+		case status.State.Waiting != nil:
+			container.State = "Waiting"
+			container.Reason = status.State.Waiting.Reason
+			container.Message = status.State.Waiting.Message
+		case status.State.Terminated != nil:
+			container.State = "Terminated"
+			container.Reason = status.State.Terminated.Reason
+			container.Message = status.State.Terminated.Message
+		}
+		info.Containers = append(info.Containers, container)
+	}
+	return info
+}
+
+// Status returns a kubectl like short status of the pod
+func (p PodInfo) Status() string {
+	if p.Reason != "" {
+		return p.Reason
+	}
+	for _, container := range p.Containers {
+		if container.Reason != "" {
+			return container.Reason
+		}
+	}
+	return p.Phase
+}
+
+func (p PodInfo) Restarts() int32 {
+	restarts := int32(0)
+	for _, container := range p.Containers {
+		restarts += container.Restarts
+	}
+	return restarts
+}
+
+// Problems explains why the workspace isn't usable, it's empty for a healthy workspace
+func (w *WorkspaceInfo) Problems() []string {
+	problems := []string{}
+	if !w.Found {
+		return append(problems, fmt.Sprintf("svc %s not found in namespace %s", w.Service, w.Namespace))
+	}
+	if len(w.Pods) == 0 {
+		if w.Deployment != "" && w.Replicas == 0 {
+			return append(problems, fmt.Sprintf("deployment %s is scaled to zero, use 'devssh start' to start it", w.Deployment))
+		} else if w.Deployment == "" {
+			return append(problems, fmt.Sprintf("no pods are selected by svc %s and there is no deployment to start them", w.Service))
+		}
+		return append(problems, fmt.Sprintf("no pods are selected by svc %s", w.Service))
+	}
+
+	for _, pod := range w.Pods {
+		if pod.Reason == "Unschedulable" {
+			problems = append(problems, fmt.Sprintf("pod %s can't be scheduled: %s", pod.Name, pod.Message))
+		}
+		for _, container := range pod.Containers {
+			if container.State == "Waiting" && container.Reason != "" && container.Reason != "ContainerCreating" && container.Reason != "PodInitializing" {
+				problems = append(problems, fmt.Sprintf("container %s of pod %s is waiting: %s %s", container.Name, pod.Name, container.Reason, container.Message))
+			} else if container.State == "Terminated" {
+				problems = append(problems, fmt.Sprintf("container %s of pod %s terminated: %s %s", container.Name, pod.Name, container.Reason, container.Message))
+			}
+			if container.Restarts >= restartWarningThreshold {
+				problems = append(problems, fmt.Sprintf("container %s of pod %s restarted %d times", container.Name, pod.Name, container.Restarts))
+			}
+		}
+	}
+	return problems
+}
@@ -0,0 +1,200 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/loft-sh/log"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	watchtools "k8s.io/client-go/tools/watch"
+)
+
+// progressReasons are the pod events that are worth showing while waiting
+var progressReasons = map[string]bool{
+	"Scheduled":        true,
+	"FailedScheduling": true,
+	"Pulling":          true,
+	"Pulled":           true,
+	"Failed":           true,
+	"BackOff":          true,
+	"Created":          true,
+	"Started":          true,
+	"Unhealthy":        true,
+	"Killing":          true,
+}
+
+// WaitForReadyPod watches the pods of the service until one of them is ready and
+// returns its name. Scheduling, image pulls and container starts are reported
+// through log while waiting.
+func WaitForReadyPod(ctx context.Context, namespace string, service string, timeout time.Duration, log log.Logger) (string, error) {
+	_, clientset := getK8sClient()
+	svc, err := clientset.CoreV1().Services(namespace).Get(ctx, service, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("get svc: %w", err)
+	}
+	if len(svc.Spec.Selector) == 0 {
+		return "", fmt.Errorf("svc %s has no selector", service)
+	}
+	selector := labels.Set(svc.Spec.Selector).AsSelector().String()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// pod names are only known from the pod watch, events of other pods are ignored
+	progress := &podProgress{pods: map[string]string{}, log: log}
+	go progress.watchEvents(ctx, clientset, namespace)
+
+	podName := ""
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.LabelSelector = selector
+			return clientset.CoreV1().Pods(namespace).List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = selector
+			return clientset.CoreV1().Pods(namespace).Watch(ctx, options)
+		},
+	}
+	_, err = watchtools.UntilWithSync(ctx, lw, &corev1.Pod{}, nil, func(event watch.Event) (bool, error) {
+		pod, ok := event.Object.(*corev1.Pod)
+		if !ok {
+			return false, nil
+		}
+		if event.Type == watch.Deleted {
+			progress.forget(pod.Name)
+			return false, nil
+		}
+		progress.update(pod)
+		if isPodReady(pod) {
+			podName = pod.Name
+			return true, nil
+		}
+		return false, nil
+	})
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("timed out after %s waiting for a ready pod of svc %s", timeout, service)
+		}
+		return "", err
+	}
+
+	log.Donef("Pod %s is ready", podName)
+	return podName, nil
+}
+
+func isPodReady(pod *corev1.Pod) bool {
+	if pod.DeletionTimestamp != nil {
+		return false
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+type podProgress struct {
+	m    sync.Mutex
+	pods map[string]string
+	log  log.Logger
+}
+
+// update reports the phase of the pod if it changed
+func (p *podProgress) update(pod *corev1.Pod) {
+	state := podWaitState(pod)
+
+	p.m.Lock()
+	defer p.m.Unlock()
+	if last, ok := p.pods[pod.Name]; ok && last == state {
+		return
+	}
+	p.pods[pod.Name] = state
+	p.log.Infof("Pod %s: %s", pod.Name, state)
+}
+
+func (p *podProgress) forget(podName string) {
+	p.m.Lock()
+	defer p.m.Unlock()
+	delete(p.pods, podName)
+}
+
+func (p *podProgress) known(podName string) bool {
+	p.m.Lock()
+	defer p.m.Unlock()
+	_, ok := p.pods[podName]
+	return ok
+}
+
+func (p *podProgress) watchEvents(ctx context.Context, clientset *kubernetes.Clientset, namespace string) {
+	watcher, err := clientset.CoreV1().Events(namespace).Watch(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("involvedObject.kind", "Pod").String(),
+	})
+	if err != nil {
+		p.log.Debugf("Error watching events: %v", err)
+		return
+	}
+	defer watcher.Stop()
+
+	// only show what happens from now on
+	since := time.Now().Add(-time.Second)
+	for event := range watcher.ResultChan() {
+		e, ok := event.Object.(*corev1.Event)
+		if !ok || event.Type == watch.Deleted || !progressReasons[e.Reason] {
+			continue
+		}
+		if e.LastTimestamp.Time.Before(since) && e.EventTime.Time.Before(since) {
+			continue
+		}
+		if !p.known(e.InvolvedObject.Name) {
+			continue
+		}
+		if e.Type == corev1.EventTypeWarning {
+			p.log.Warnf("Pod %s: %s", e.InvolvedObject.Name, e.Message)
+		} else {
+			p.log.Infof("Pod %s: %s", e.InvolvedObject.Name, e.Message)
+		}
+	}
+}
+
+func podWaitState(pod *corev1.Pod) string {
+	if pod.DeletionTimestamp != nil {
+		return "terminating"
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodScheduled && condition.Status != corev1.ConditionTrue {
+			if condition.Message != "" {
+				return "waiting to be scheduled: " + condition.Message
+			}
+			return "waiting to be scheduled"
+		}
+	}
+	for _, status := range pod.Status.InitContainerStatuses {
+		if status.State.Running != nil {
+			return "running init container " + status.Name
+		}
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Waiting != nil && status.State.Waiting.Reason != "" {
+			return status.Name + " " + status.State.Waiting.Reason
+		} else if status.State.Terminated != nil {
+			return status.Name + " terminated: " + status.State.Terminated.Reason
+		}
+	}
+	if isPodReady(pod) {
+		return "ready"
+	}
+	if pod.Status.Phase == corev1.PodRunning {
+		return "started, waiting for readiness"
+	}
+	return "starting"
+}
@@ -0,0 +1,256 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/loft-sh/log"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// WorkspaceLabel marks the objects devssh created for a workspace, its value is the service name
+const WorkspaceLabel = "devssh/workspace"
+
+// WorkspaceMountPath is where the workspace volume is mounted, it matches the ssh-server workdir
+const WorkspaceMountPath = "/workspaces"
+
+type WorkspaceOptions struct {
+	Namespace string
+	Service   string
+
+	// Image runs a deployment with a single container of this image
+	Image string
+	// Template is a path to a pod or deployment manifest used instead of Image
+	Template string
+	// Storage is the size of a persistent volume mounted at WorkspaceMountPath
+	Storage string
+}
+
+func workspaceLabels(service string) map[string]string {
+	return map[string]string{WorkspaceLabel: service}
+}
+
+// CreateWorkspace creates the workload and the service of a new workspace. Objects
+// that already exist are kept, so a failed call can be retried, and the objects this
+// call created are deleted again if a later one fails.
+func CreateWorkspace(ctx context.Context, options WorkspaceOptions, log log.Logger) (err error) {
+	_, clientset := getK8sClient()
+	namespace := options.Namespace
+
+	var (
+		deployment *appsv1.Deployment
+		pod        *corev1.Pod
+	)
+	if options.Template != "" {
+		deployment, pod, err = loadTemplate(options.Template)
+		if err != nil {
+			return err
+		}
+	} else if options.Image != "" {
+		deployment = defaultDeployment(options.Service, options.Image)
+	} else {
+		return fmt.Errorf("please specify an image or a template")
+	}
+
+	// a template is either a pod or a deployment
+	var podSpec *corev1.PodSpec
+	if pod != nil {
+		podSpec = &pod.Spec
+	} else {
+		podSpec = &deployment.Spec.Template.Spec
+	}
+
+	created := []func(ctx context.Context) error{}
+	defer func() {
+		if err == nil {
+			return
+		}
+		// the context may be what failed, the cleanup shouldn't depend on it
+		cleanupCtx := context.Background()
+		for i := len(created) - 1; i >= 0; i-- {
+			if cleanupErr := created[i](cleanupCtx); cleanupErr != nil && !errors.IsNotFound(cleanupErr) {
+				log.Warnf("Error cleaning up: %v", cleanupErr)
+			}
+		}
+	}()
+
+	if options.Storage != "" {
+		name := workspaceVolumeName(options.Service)
+		ok, err := createWorkspaceVolume(ctx, namespace, options.Service, options.Storage)
+		if err != nil {
+			return err
+		} else if ok {
+			created = append(created, func(ctx context.Context) error {
+				log.Infof("Delete volume %s/%s", namespace, name)
+				return clientset.CoreV1().PersistentVolumeClaims(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+			})
+		}
+		mountWorkspaceVolume(podSpec, options.Service)
+	}
+
+	if pod != nil {
+		if pod.Name == "" {
+			pod.Name = options.Service
+		}
+		pod.Labels = labels.Merge(pod.Labels, workspaceLabels(options.Service))
+		log.Infof("Create pod %s/%s", namespace, pod.Name)
+		_, err = clientset.CoreV1().Pods(namespace).Create(ctx, pod, metav1.CreateOptions{})
+		if errors.IsAlreadyExists(err) {
+			log.Infof("Pod %s/%s already exists", namespace, pod.Name)
+		} else if err != nil {
+			return fmt.Errorf("create pod: %w", err)
+		} else {
+			name := pod.Name
+			created = append(created, func(ctx context.Context) error {
+				log.Infof("Delete pod %s/%s", namespace, name)
+				return clientset.CoreV1().Pods(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+			})
+		}
+	} else {
+		if deployment.Name == "" {
+			deployment.Name = options.Service
+		}
+		deployment.Labels = labels.Merge(deployment.Labels, workspaceLabels(options.Service))
+		deployment.Spec.Template.Labels = labels.Merge(deployment.Spec.Template.Labels, workspaceLabels(options.Service))
+		deployment.Spec.Selector = &metav1.LabelSelector{MatchLabels: workspaceLabels(options.Service)}
+		log.Infof("Create deployment %s/%s", namespace, deployment.Name)
+		_, err = clientset.AppsV1().Deployments(namespace).Create(ctx, deployment, metav1.CreateOptions{})
+		if errors.IsAlreadyExists(err) {
+			log.Infof("Deployment %s/%s already exists", namespace, deployment.Name)
+		} else if err != nil {
+			return fmt.Errorf("create deployment: %w", err)
+		} else {
+			name := deployment.Name
+			created = append(created, func(ctx context.Context) error {
+				log.Infof("Delete deployment %s/%s", namespace, name)
+				return clientset.AppsV1().Deployments(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+			})
+		}
+	}
+
+	// devssh only uses the service to find the pods, so a headless one is enough
+	log.Infof("Create service %s/%s", namespace, options.Service)
+	_, err = clientset.CoreV1().Services(namespace).Create(ctx, &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   options.Service,
+			Labels: workspaceLabels(options.Service),
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: corev1.ClusterIPNone,
+			Selector:  workspaceLabels(options.Service),
+		},
+	}, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		log.Infof("Service %s/%s already exists", namespace, options.Service)
+		err = nil
+	} else if err != nil {
+		return fmt.Errorf("create service: %w", err)
+	}
+
+	return nil
+}
+
+func defaultDeployment(service string, image string) *appsv1.Deployment {
+	replicas := int32(1)
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: service,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Strategy: appsv1.DeploymentStrategy{
+				// a workspace volume can only be attached to one pod
+				Type: appsv1.RecreateDeploymentStrategyType,
+			},
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:    "workspace",
+						Image:   image,
+						Command: []string{"sh", "-c", "trap 'exit 0' TERM; sleep infinity & wait"},
+					}},
+				},
+			},
+		},
+	}
+}
+
+func loadTemplate(path string) (*appsv1.Deployment, *corev1.Pod, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read template: %w", err)
+	}
+
+	obj, _, err := scheme.Codecs.UniversalDeserializer().Decode(raw, nil, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decode template: %w", err)
+	}
+
+	switch o := obj.(type) {
+	case *appsv1.Deployment:
+		o.Namespace = ""
+		return o, nil, nil
+	case *corev1.Pod:
+		o.Namespace = ""
+		return nil, o, nil
+	default:
+		return nil, nil, fmt.Errorf("template %s has to be a Pod or a Deployment", path)
+	}
+}
+
+func workspaceVolumeName(service string) string {
+	return service + "-workspace"
+}
+
+// createWorkspaceVolume creates the workspace volume and reports whether it was created
+// by this call, an existing volume is kept with its data
+func createWorkspaceVolume(ctx context.Context, namespace string, service string, storage string) (bool, error) {
+	size, err := resource.ParseQuantity(storage)
+	if err != nil {
+		return false, fmt.Errorf("parse storage size: %w", err)
+	}
+
+	_, clientset := getK8sClient()
+	_, err = clientset.CoreV1().PersistentVolumeClaims(namespace).Create(ctx, &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   workspaceVolumeName(service),
+			Labels: workspaceLabels(service),
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: size},
+			},
+		},
+	}, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("create workspace volume: %w", err)
+	}
+	return true, nil
+}
+
+func mountWorkspaceVolume(spec *corev1.PodSpec, service string) {
+	spec.Volumes = append(spec.Volumes, corev1.Volume{
+		Name: "workspace",
+		VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: workspaceVolumeName(service),
+			},
+		},
+	})
+	for i := range spec.Containers {
+		spec.Containers[i].VolumeMounts = append(spec.Containers[i].VolumeMounts, corev1.VolumeMount{
+			Name:      "workspace",
+			MountPath: WorkspaceMountPath,
+		})
+	}
+}
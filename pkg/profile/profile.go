@@ -0,0 +1,190 @@
+package profile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/2017fighting/devssh/pkg/provider"
+	"sigs.k8s.io/yaml"
+)
+
+// Profile holds the options of a devssh ssh invocation under a name
+type Profile struct {
+	Context     string   `json:"context,omitempty"`
+	Namespace   string   `json:"namespace,omitempty"`
+	Service     string   `json:"service,omitempty"`
+	Container   string   `json:"container,omitempty"`
+	User        string   `json:"user,omitempty"`
+	DebugImage  string   `json:"debugImage,omitempty"`
+	Wait        bool     `json:"wait,omitempty"`
+	WaitTimeout string   `json:"waitTimeout,omitempty"`
+	Forwards    []string `json:"forwards,omitempty"`
+	Dynamic     []string `json:"dynamicForwards,omitempty"`
+	Mounts      []string `json:"mounts,omitempty"`
+	Env         []string `json:"env,omitempty"`
+	SendEnv     []string `json:"sendEnv,omitempty"`
+	EnvFile     string   `json:"envFile,omitempty"`
+	ForwardX11  bool     `json:"forwardX11,omitempty"`
+	ForwardGPG  bool     `json:"forwardGPG,omitempty"`
+	ForwardKube bool     `json:"forwardKubeConfig,omitempty"`
+	Browser     bool     `json:"forwardBrowser,omitempty"`
+	Clipboard   bool     `json:"clipboard,omitempty"`
+
+	Dotfiles       string `json:"dotfiles,omitempty"`
+	DotfilesDir    string `json:"dotfilesDir,omitempty"`
+	DotfilesScript string `json:"dotfilesScript,omitempty"`
+
+	ForwardAgent *bool    `json:"forwardAgent,omitempty"`
+	NoAddKeys    bool     `json:"noAddKeys,omitempty"`
+	Identities   []string `json:"identities,omitempty"`
+	AgentConfirm bool     `json:"agentConfirm,omitempty"`
+
+	Multiplex      bool   `json:"multiplex,omitempty"`
+	ControlPersist string `json:"controlPersist,omitempty"`
+
+	NoDevContainer bool `json:"noDevContainer,omitempty"`
+}
+
+type Config struct {
+	Profiles map[string]*Profile `json:"profiles,omitempty"`
+}
+
+// Flags returns the profile as values of the devssh ssh flags, unset options are left out
+func (p *Profile) Flags() map[string][]string {
+	flags := map[string][]string{}
+	set := func(name string, value string) {
+		if value != "" {
+			flags[name] = []string{value}
+		}
+	}
+
+	set("context", p.Context)
+	set("ns", p.Namespace)
+	set("svc", p.Service)
+	set("container", p.Container)
+	set("user", p.User)
+	set("debug-image", p.DebugImage)
+	if p.Wait {
+		set("wait", strconv.FormatBool(p.Wait))
+	}
+	set("wait-timeout", p.WaitTimeout)
+	if len(p.Forwards) > 0 {
+		flags["forward"] = p.Forwards
+	}
+	if len(p.Dynamic) > 0 {
+		flags["dynamic-forward"] = p.Dynamic
+	}
+	if len(p.Mounts) > 0 {
+		flags["mount"] = p.Mounts
+	}
+	if len(p.Env) > 0 {
+		flags["env"] = p.Env
+	}
+	if len(p.SendEnv) > 0 {
+		flags["send-env"] = p.SendEnv
+	}
+	set("env-file", p.EnvFile)
+	if p.ForwardX11 {
+		set("forward-x11", strconv.FormatBool(p.ForwardX11))
+	}
+	if p.ForwardGPG {
+		set("gpg-agent-forwarding", strconv.FormatBool(p.ForwardGPG))
+	}
+	set("dotfiles", p.Dotfiles)
+	set("dotfiles-dir", p.DotfilesDir)
+	set("dotfiles-script", p.DotfilesScript)
+	if p.ForwardKube {
+		set("forward-kubeconfig", strconv.FormatBool(p.ForwardKube))
+	}
+	if p.Browser {
+		set("forward-browser", strconv.FormatBool(p.Browser))
+	}
+	if p.Clipboard {
+		set("clipboard", strconv.FormatBool(p.Clipboard))
+	}
+	if p.ForwardAgent != nil {
+		set("forward-agent", strconv.FormatBool(*p.ForwardAgent))
+	}
+	if p.NoAddKeys {
+		set("no-add-keys", strconv.FormatBool(p.NoAddKeys))
+	}
+	if len(p.Identities) > 0 {
+		flags["identity"] = p.Identities
+	}
+	if p.AgentConfirm {
+		set("agent-confirm", strconv.FormatBool(p.AgentConfirm))
+	}
+	if p.Multiplex {
+		set("multiplex", strconv.FormatBool(p.Multiplex))
+	}
+	set("control-persist", p.ControlPersist)
+	if p.NoDevContainer {
+		set("no-devcontainer", strconv.FormatBool(p.NoDevContainer))
+	}
+	return flags
+}
+
+func Load() (*Config, error) {
+	path, err := provider.GetProfilesPath()
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Config{}
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("read profiles: %w", err)
+	}
+
+	err = yaml.Unmarshal(raw, config)
+	if err != nil {
+		return nil, fmt.Errorf("parse profiles %s: %w", path, err)
+	}
+	return config, nil
+}
+
+func Save(config *Config) error {
+	path, err := provider.GetProfilesPath()
+	if err != nil {
+		return err
+	}
+
+	raw, err := yaml.Marshal(config)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, raw, 0600)
+}
+
+// Get loads the profile with the given name
+func Get(name string) (*Profile, error) {
+	config, err := Load()
+	if err != nil {
+		return nil, err
+	}
+
+	profile, ok := config.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile %s not found, see 'devssh profile list'", name)
+	}
+	return profile, nil
+}
+
+// Names returns the sorted profile names
+func (c *Config) Names() []string {
+	names := []string{}
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
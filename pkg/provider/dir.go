@@ -2,14 +2,58 @@ package provider
 
 import (
 	"path/filepath"
+	"regexp"
 
 	"github.com/loft-sh/devpod/pkg/config"
 )
 
-func GetLocksDir(service string) (string, error) {
+// unsafePathChars are replaced in kube context names, which are often urls or arns
+var unsafePathChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// GetLocksRoot returns the directory holding the locks of all workspaces
+func GetLocksRoot() (string, error) {
+	configDir, err := config.GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "devssh-locks"), nil
+}
+
+// GetLocksDir returns the lock directory of a workspace, services of the same name in
+// other namespaces or clusters don't share it
+func GetLocksDir(kubeContext string, namespace string, service string) (string, error) {
+	root, err := GetLocksRoot()
+	if err != nil {
+		return "", err
+	}
+	if kubeContext == "" {
+		kubeContext = "default"
+	}
+	return filepath.Join(root, unsafePathChars.ReplaceAllString(kubeContext, "_"), namespace, service), nil
+}
+
+// GetControlDir returns the directory holding the sockets of the connection masters
+func GetControlDir() (string, error) {
+	configDir, err := config.GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "devssh-control"), nil
+}
+
+// GetSyncDir returns the directory holding the state of devssh sync sessions
+func GetSyncDir() (string, error) {
+	configDir, err := config.GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "devssh-sync"), nil
+}
+
+func GetProfilesPath() (string, error) {
 	configDir, err := config.GetConfigDir()
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(configDir, service, "locks"), nil
+	return filepath.Join(configDir, "devssh-profiles.yaml"), nil
 }
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// envNameRegexp matches the names a shell can export. The names end up unquoted in
+// the command of su, so anything else is rejected even if a pattern matches it.
+var envNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// DefaultAcceptEnv are the variables a client may always send, like AcceptEnv in sshd
+var DefaultAcceptEnv = []string{"LANG", "LANGUAGE", "LC_*", "TZ", "COLORTERM", "TERM_PROGRAM", "TERM_PROGRAM_VERSION", "GIT_CONFIG_COUNT", "GIT_CONFIG_KEY_*", "GIT_CONFIG_VALUE_*", "KUBECONFIG"}
+
+type Option func(*Server)
+
+// WithAcceptEnv allows the variables matching one of the glob patterns in addition to DefaultAcceptEnv
+func WithAcceptEnv(patterns []string) Option {
+	return func(s *Server) {
+		s.acceptEnv = append(s.acceptEnv, patterns...)
+	}
+}
+
+func (s *Server) isEnvAccepted(name string) bool {
+	for _, pattern := range s.acceptEnv {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// filterSession rejects env requests of the session that aren't accepted, so the
+// client gets a failure instead of the variable being silently dropped. It also
+// passes what the ssh library doesn't support, like x11-req, host-forward and
+// the terminal modes, to the session handler as internal env requests.
+func (s *Server) filterSession(newChan gossh.NewChannel) gossh.NewChannel {
+	return &filteredChannel{NewChannel: newChan, server: s}
+}
+
+type filteredChannel struct {
+	gossh.NewChannel
+
+	server *Server
+}
+
+func (c *filteredChannel) Accept() (gossh.Channel, <-chan *gossh.Request, error) {
+	channel, requests, err := c.NewChannel.Accept()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	filtered := make(chan *gossh.Request)
+	go func() {
+		defer close(filtered)
+
+		for req := range requests {
+			if req.Type == "env" && !c.acceptEnvRequest(req) {
+				_ = req.Reply(false, nil)
+				continue
+			}
+			if req.Type == "x11-req" {
+				if x11Req := c.server.acceptX11Request(req); x11Req != nil {
+					filtered <- x11Req
+				}
+				continue
+			}
+			if req.Type == HostForwardRequest {
+				filtered <- acceptHostRequest(req)
+				continue
+			}
+			if req.Type == "pty-req" {
+				if modesReq := terminalModesRequest(req); modesReq != nil {
+					filtered <- modesReq
+				}
+			}
+			filtered <- req
+		}
+	}()
+	return channel, filtered, nil
+}
+
+func (c *filteredChannel) acceptEnvRequest(req *gossh.Request) bool {
+	var kv struct{ Key, Value string }
+	if err := gossh.Unmarshal(req.Payload, &kv); err != nil {
+		return false
+	}
+	if !envNameRegexp.MatchString(kv.Key) || isInternalEnv(kv.Key) || !c.server.isEnvAccepted(kv.Key) {
+		c.server.log.Debugf("Rejected env %s", kv.Key)
+		return false
+	}
+	return true
+}
+
+// loginCommand exports env in front of command, or the login shell of the user if command is empty
+func loginCommand(env []string, command string) string {
+	exports := make([]string, 0, len(env))
+	for _, kv := range env {
+		name, value, _ := strings.Cut(kv, "=")
+		exports = append(exports, name+"="+shellescape.Quote(value))
+	}
+	if command == "" {
+		command = `exec "$SHELL" -l`
+	}
+	return "export " + strings.Join(exports, " ") + "; " + pathExport(env) + command
+}
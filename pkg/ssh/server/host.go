@@ -0,0 +1,194 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/2017fighting/devssh/pkg/agent"
+	"github.com/alessio/shellescape"
+	"github.com/loft-sh/ssh"
+	perrors "github.com/pkg/errors"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+const (
+	// HostForwardRequest asks to forward urls and clipboard contents of the session to the client
+	HostForwardRequest = "host-forward@devssh"
+	// HostChannel is opened to the client for every request of the session
+	HostChannel = "host@devssh"
+
+	// hostEnv carries an accepted host-forward request to the session handler, see terminalModesEnv
+	hostEnv = "DEVSSH_HOST_FORWARD"
+	// hostBinEnv is the dir of xdg-open in sessions of another user, their login sets PATH
+	hostBinEnv = "DEVSSH_HOST_BIN"
+
+	// profileHook puts hostBinEnv in front of PATH in login shells
+	profileHook     = "/etc/profile.d/devssh-host.sh"
+	profileHookBody = `# written by devssh ssh-server, puts the xdg-open of browser forwarding first
+if [ -n "$DEVSSH_HOST_BIN" ]; then
+	case ":$PATH:" in
+	*":$DEVSSH_HOST_BIN:"*) ;;
+	*) PATH="$DEVSSH_HOST_BIN:$PATH"; export PATH ;;
+	esac
+fi
+`
+)
+
+// acceptHostRequest replies to the host-forward request and returns an env request for the session handler
+func acceptHostRequest(req *gossh.Request) *gossh.Request {
+	_ = req.Reply(true, nil)
+	return &gossh.Request{
+		Type: "env",
+		Payload: gossh.Marshal(struct{ Key, Value string }{
+			Key:   hostEnv,
+			Value: "1",
+		}),
+	}
+}
+
+func sessionHostForward(sess ssh.Session) bool {
+	for _, kv := range sess.Environ() {
+		if kv == hostEnv+"=1" {
+			return true
+		}
+	}
+	return false
+}
+
+type hostForward struct {
+	listener net.Listener
+	dir      string
+}
+
+// startHostForward listens on a socket only the session user can use and opens a host
+// channel to the client for every connection to it. The session gets BROWSER and an
+// xdg-open that send urls there. It returns env with the variables added.
+func (s *Server) startHostForward(sess ssh.Session, user string, env []string) (*hostForward, []string, error) {
+	conn, ok := sess.Context().Value(ssh.ContextKeyConn).(gossh.Conn)
+	if !ok {
+		return nil, nil, fmt.Errorf("no ssh connection")
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	forward := &hostForward{}
+	forward.dir, err = os.MkdirTemp("", "devssh-host-")
+	if err != nil {
+		return nil, nil, err
+	}
+	if !filepath.IsAbs(forward.dir) {
+		// a login shell resets PATH, BROWSER has to work without it
+		forward.Close()
+		return nil, nil, fmt.Errorf("temp dir %s isn't an absolute path", forward.dir)
+	}
+	socketPath := filepath.Join(forward.dir, "host.sock")
+	forward.listener, err = net.Listen("unix", socketPath)
+	if err != nil {
+		forward.Close()
+		return nil, nil, perrors.Wrap(err, "listen on host socket")
+	}
+
+	binDir := filepath.Join(forward.dir, "bin")
+	opener := filepath.Join(binDir, "xdg-open")
+	err = os.MkdirAll(binDir, 0o755)
+	if err == nil {
+		script := fmt.Sprintf("#!/bin/sh\nexec %s agent open \"$@\"\n", shellescape.Quote(executable))
+		err = os.WriteFile(opener, []byte(script), 0o755)
+	}
+	if err != nil {
+		forward.Close()
+		return nil, nil, perrors.Wrap(err, "write xdg-open")
+	}
+
+	if user != "" {
+		// the session runs as another user, who is the only one allowed to use the socket
+		out, err := exec.Command("chown", "-R", user, forward.dir).CombinedOutput()
+		if err != nil {
+			forward.Close()
+			return nil, nil, perrors.Wrapf(err, "chown host socket: %s", strings.TrimSpace(string(out)))
+		}
+	}
+
+	go forward.serve(conn, s)
+	if user != "" {
+		// the login of another user sets its own PATH, the profile hook and
+		// loginCommand put the dir in front of it
+		err = os.WriteFile(profileHook, []byte(profileHookBody), 0o644)
+		if err != nil {
+			s.log.Debugf("Error writing %s: %v", profileHook, err)
+		}
+		env = append(env, hostBinEnv+"="+binDir)
+	} else {
+		env = prependPath(env, binDir)
+	}
+	return forward, append(env, "BROWSER="+opener, agent.HostSocketEnv+"="+socketPath), nil
+}
+
+// pathExport returns the shell to put the xdg-open of the session in front of PATH,
+// or nothing if the session doesn't forward urls as another user
+func pathExport(env []string) string {
+	for _, kv := range env {
+		if strings.HasPrefix(kv, hostBinEnv+"=") {
+			return `PATH="$` + hostBinEnv + `:$PATH"; export PATH; `
+		}
+	}
+	return ""
+}
+
+// prependPath puts dir in front of the PATH of the session env, without one the
+// session inherits the PATH of the server
+func prependPath(env []string, dir string) []string {
+	result := make([]string, 0, len(env)+1)
+	found := false
+	for _, kv := range env {
+		if value, ok := strings.CutPrefix(kv, "PATH="); ok {
+			kv = "PATH=" + dir + string(os.PathListSeparator) + value
+			found = true
+		}
+		result = append(result, kv)
+	}
+	if !found {
+		result = append(result, "PATH="+dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	}
+	return result
+}
+
+func (f *hostForward) serve(conn gossh.Conn, s *Server) {
+	for {
+		local, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			defer local.Close()
+
+			channel, requests, err := conn.OpenChannel(HostChannel, nil)
+			if err != nil {
+				s.log.Debugf("Error opening host channel: %v", err)
+				_, _ = fmt.Fprintf(local, "{\"error\":%q}\n", "the client doesn't accept host requests")
+				return
+			}
+			defer channel.Close()
+			go gossh.DiscardRequests(requests)
+
+			pipe(local, channel)
+		}()
+	}
+}
+
+// Close stops listening and removes the socket and xdg-open
+func (f *hostForward) Close() {
+	if f.listener != nil {
+		_ = f.listener.Close()
+	}
+	if f.dir != "" {
+		_ = os.RemoveAll(f.dir)
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+
+	"github.com/loft-sh/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// terminalModesEnv carries the modes of a pty-req to the session handler, the
+// ssh library drops them while parsing the request
+const terminalModesEnv = "DEVSSH_TERMINAL_MODES"
+
+// terminalModesRequest returns an env request holding the modes of the pty-req, nil if it has none
+func terminalModesRequest(req *gossh.Request) *gossh.Request {
+	var ptyReq struct {
+		Term          string
+		Columns, Rows uint32
+		Width, Height uint32
+		Modes         string
+	}
+	if err := gossh.Unmarshal(req.Payload, &ptyReq); err != nil || ptyReq.Modes == "" {
+		return nil
+	}
+
+	return &gossh.Request{
+		Type: "env",
+		Payload: gossh.Marshal(struct{ Key, Value string }{
+			Key:   terminalModesEnv,
+			Value: hex.EncodeToString([]byte(ptyReq.Modes)),
+		}),
+	}
+}
+
+// terminalModes decodes the modes of the session, see RFC 4254 section 8
+func terminalModes(sess ssh.Session) gossh.TerminalModes {
+	modes := gossh.TerminalModes{}
+	for _, kv := range sess.Environ() {
+		value, ok := strings.CutPrefix(kv, terminalModesEnv+"=")
+		if !ok {
+			continue
+		}
+		raw, err := hex.DecodeString(value)
+		if err != nil {
+			return modes
+		}
+		for len(raw) >= 5 && raw[0] != 0 {
+			modes[raw[0]] = binary.BigEndian.Uint32(raw[1:5])
+			raw = raw[5:]
+		}
+	}
+	return modes
+}
+
+// isInternalEnv reports whether name is used to pass requests to the session handler
+func isInternalEnv(name string) bool {
+	return name == terminalModesEnv || name == x11Env || name == hostEnv || name == hostBinEnv
+}
+
+// sessionEnv returns the variables the client set, without the internal ones
+func sessionEnv(sess ssh.Session) []string {
+	env := []string{}
+	for _, kv := range sess.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if !isInternalEnv(name) {
+			env = append(env, kv)
+		}
+	}
+	return env
+}
@@ -0,0 +1,49 @@
+//go:build !windows
+// +build !windows
+
+package server
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"unsafe"
+
+	"github.com/2017fighting/devssh/pkg/ssh/terminal"
+	"github.com/creack/pty"
+	"github.com/loft-sh/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// startPTY starts cmd on a new pty with the modes and size of the client terminal
+func startPTY(cmd *exec.Cmd, modes gossh.TerminalModes, win ssh.Window) (*os.File, error) {
+	f, tty, err := pty.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer tty.Close()
+
+	// a failure only leaves the pty defaults
+	_ = terminal.ApplyModes(int(tty.Fd()), modes)
+	setWinSize(f, win.Width, win.Height)
+
+	cmd.Stdin = tty
+	cmd.Stdout = tty
+	cmd.Stderr = tty
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setsid = true
+	cmd.SysProcAttr.Setctty = true
+	err = cmd.Start()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func setWinSize(f *os.File, w, h int) {
+	_, _, _ = syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(syscall.TIOCSWINSZ),
+		uintptr(unsafe.Pointer(&struct{ h, w, x, y uint16 }{uint16(h), uint16(w), 0, 0})))
+}
@@ -0,0 +1,21 @@
+//go:build windows
+// +build windows
+
+package server
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/loft-sh/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func startPTY(cmd *exec.Cmd, modes gossh.TerminalModes, win ssh.Window) (*os.File, error) {
+	return nil, fmt.Errorf("pty is currently not supported on windows")
+}
+
+func setWinSize(f *os.File, w, h int) {
+
+}
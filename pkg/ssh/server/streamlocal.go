@@ -0,0 +1,40 @@
+package server
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+
+	"github.com/loft-sh/log"
+	"github.com/loft-sh/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// chownForwardedSockets hands sockets of remote streamlocal forwards to the session
+// user, the ssh-server creates them as its own user otherwise and e.g. a forwarded
+// gpg-agent couldn't be used by the session
+func chownForwardedSockets(handler ssh.RequestHandler, currentUser string, log log.Logger) ssh.RequestHandler {
+	return func(ctx ssh.Context, srv *ssh.Server, req *gossh.Request) (bool, []byte) {
+		ok, payload := handler(ctx, srv, req)
+		if !ok || req.Type != "streamlocal-forward@openssh.com" || ctx.User() == currentUser {
+			return ok, payload
+		}
+
+		var forward struct{ SocketPath string }
+		if gossh.Unmarshal(req.Payload, &forward) != nil {
+			return ok, payload
+		}
+		u, err := user.Lookup(ctx.User())
+		if err != nil {
+			log.Debugf("Error looking up user %s: %v", ctx.User(), err)
+			return ok, payload
+		}
+		uid, _ := strconv.Atoi(u.Uid)
+		gid, _ := strconv.Atoi(u.Gid)
+		err = os.Chown(forward.SocketPath, uid, gid)
+		if err != nil {
+			log.Debugf("Error changing owner of %s: %v", forward.SocketPath, err)
+		}
+		return ok, payload
+	}
+}
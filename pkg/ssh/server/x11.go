@@ -0,0 +1,212 @@
+package server
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/loft-sh/devpod/pkg/command"
+	"github.com/loft-sh/ssh"
+	perrors "github.com/pkg/errors"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// x11Env carries an accepted x11-req to the session handler, see terminalModesEnv
+const x11Env = "DEVSSH_X11"
+
+const (
+	x11SocketDir     = "/tmp/.X11-unix"
+	x11DisplayOffset = 10
+	x11MaxDisplays   = 1000
+)
+
+type x11Request struct {
+	SingleConnection bool
+	AuthProtocol     string
+	AuthCookie       string
+	ScreenNumber     uint32
+}
+
+// acceptX11Request replies to the x11-req and returns an env request holding it
+// for the session handler, nil if X11 forwarding isn't possible in the container
+func (s *Server) acceptX11Request(req *gossh.Request) *gossh.Request {
+	x11 := x11Request{}
+	if err := gossh.Unmarshal(req.Payload, &x11); err != nil {
+		_ = req.Reply(false, nil)
+		return nil
+	}
+	if _, err := hex.DecodeString(x11.AuthCookie); err != nil || x11.AuthCookie == "" {
+		_ = req.Reply(false, nil)
+		return nil
+	}
+	// without an xauth entry every local user could connect to the display
+	if !command.Exists("xauth") {
+		s.log.Debugf("Rejected X11 forwarding: xauth not found")
+		_ = req.Reply(false, nil)
+		return nil
+	}
+
+	_ = req.Reply(true, nil)
+	return &gossh.Request{
+		Type: "env",
+		Payload: gossh.Marshal(struct{ Key, Value string }{
+			Key:   x11Env,
+			Value: hex.EncodeToString(gossh.Marshal(x11)),
+		}),
+	}
+}
+
+func sessionX11Request(sess ssh.Session) *x11Request {
+	for _, kv := range sess.Environ() {
+		value, ok := strings.CutPrefix(kv, x11Env+"=")
+		if !ok {
+			continue
+		}
+		raw, err := hex.DecodeString(value)
+		if err != nil {
+			return nil
+		}
+		x11 := &x11Request{}
+		if gossh.Unmarshal(raw, x11) != nil {
+			return nil
+		}
+		return x11
+	}
+	return nil
+}
+
+type x11Forward struct {
+	listener   net.Listener
+	socketPath string
+	authDir    string
+}
+
+// startX11 listens on a free display and opens an x11 channel to the client for
+// every connection to it. It returns the DISPLAY and XAUTHORITY of the session.
+func (s *Server) startX11(sess ssh.Session, x11 *x11Request, user string) (*x11Forward, []string, error) {
+	conn, ok := sess.Context().Value(ssh.ContextKeyConn).(gossh.Conn)
+	if !ok {
+		return nil, nil, fmt.Errorf("no ssh connection")
+	}
+
+	err := os.MkdirAll(x11SocketDir, 0o1777)
+	if err != nil {
+		return nil, nil, perrors.Wrap(err, "create x11 socket dir")
+	}
+	forward := &x11Forward{}
+	display := 0
+	for display = x11DisplayOffset; display < x11DisplayOffset+x11MaxDisplays; display++ {
+		socketPath := filepath.Join(x11SocketDir, "X"+strconv.Itoa(display))
+		if _, err := os.Stat(socketPath); err == nil {
+			continue
+		}
+		forward.listener, err = net.Listen("unix", socketPath)
+		if err == nil {
+			forward.socketPath = socketPath
+			break
+		}
+	}
+	if forward.listener == nil {
+		return nil, nil, fmt.Errorf("no free X11 display")
+	}
+	// the cookie protects the display, the socket has to be usable by the session user
+	_ = os.Chmod(forward.socketPath, 0o777)
+
+	displayName := fmt.Sprintf(":%d.%d", display, x11.ScreenNumber)
+	xauthority, err := forward.writeXauthority(displayName, x11, user)
+	if err != nil {
+		forward.Close()
+		return nil, nil, err
+	}
+
+	go forward.serve(conn, x11.SingleConnection, s)
+	return forward, []string{"DISPLAY=" + displayName, "XAUTHORITY=" + xauthority}, nil
+}
+
+func (f *x11Forward) writeXauthority(display string, x11 *x11Request, user string) (string, error) {
+	var err error
+	f.authDir, err = os.MkdirTemp("", "devssh-x11-")
+	if err != nil {
+		return "", err
+	}
+	xauthority := filepath.Join(f.authDir, "Xauthority")
+	out, err := exec.Command("xauth", "-q", "-f", xauthority, "add", display, x11.AuthProtocol, x11.AuthCookie).CombinedOutput()
+	if err != nil {
+		return "", perrors.Wrapf(err, "xauth add: %s", strings.TrimSpace(string(out)))
+	}
+
+	if user != "" {
+		// the session runs as another user, who has to be able to read the cookie
+		out, err = exec.Command("chown", "-R", user, f.authDir).CombinedOutput()
+		if err != nil {
+			return "", perrors.Wrapf(err, "chown xauthority: %s", strings.TrimSpace(string(out)))
+		}
+	}
+	return xauthority, nil
+}
+
+func (f *x11Forward) serve(conn gossh.Conn, singleConnection bool, s *Server) {
+	for {
+		local, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		if singleConnection {
+			_ = f.listener.Close()
+		}
+
+		go func() {
+			defer local.Close()
+
+			channel, requests, err := conn.OpenChannel("x11", gossh.Marshal(struct {
+				OriginatorAddress string
+				OriginatorPort    uint32
+			}{"127.0.0.1", 0}))
+			if err != nil {
+				s.log.Debugf("Error opening x11 channel: %v", err)
+				return
+			}
+			defer channel.Close()
+			go gossh.DiscardRequests(requests)
+
+			pipe(local, channel)
+		}()
+	}
+}
+
+// Close stops listening on the display and removes its socket and cookie
+func (f *x11Forward) Close() {
+	if f.listener != nil {
+		_ = f.listener.Close()
+	}
+	if f.socketPath != "" {
+		_ = os.Remove(f.socketPath)
+	}
+	if f.authDir != "" {
+		_ = os.RemoveAll(f.authDir)
+	}
+}
+
+// pipe copies between a and b until both directions are done
+func pipe(a io.ReadWriteCloser, b gossh.Channel) {
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(a, b)
+		_ = a.Close()
+	}()
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(b, a)
+		_ = b.CloseWrite()
+	}()
+	wg.Wait()
+}
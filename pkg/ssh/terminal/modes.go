@@ -0,0 +1,150 @@
+//go:build linux || darwin
+
+package terminal
+
+import (
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/sys/unix"
+)
+
+type flagMode struct {
+	opcode uint8
+	mask   uint64
+}
+
+// the modes OpenSSH sends, see RFC 4254 section 8
+var (
+	controlChars = map[uint8]int{
+		ssh.VINTR:    unix.VINTR,
+		ssh.VQUIT:    unix.VQUIT,
+		ssh.VERASE:   unix.VERASE,
+		ssh.VKILL:    unix.VKILL,
+		ssh.VEOF:     unix.VEOF,
+		ssh.VEOL:     unix.VEOL,
+		ssh.VEOL2:    unix.VEOL2,
+		ssh.VSTART:   unix.VSTART,
+		ssh.VSTOP:    unix.VSTOP,
+		ssh.VSUSP:    unix.VSUSP,
+		ssh.VREPRINT: unix.VREPRINT,
+		ssh.VWERASE:  unix.VWERASE,
+		ssh.VLNEXT:   unix.VLNEXT,
+		ssh.VDISCARD: unix.VDISCARD,
+	}
+	inputModes = []flagMode{
+		{ssh.IGNPAR, unix.IGNPAR},
+		{ssh.PARMRK, unix.PARMRK},
+		{ssh.INPCK, unix.INPCK},
+		{ssh.ISTRIP, unix.ISTRIP},
+		{ssh.INLCR, unix.INLCR},
+		{ssh.IGNCR, unix.IGNCR},
+		{ssh.ICRNL, unix.ICRNL},
+		{ssh.IXON, unix.IXON},
+		{ssh.IXANY, unix.IXANY},
+		{ssh.IXOFF, unix.IXOFF},
+		{ssh.IMAXBEL, unix.IMAXBEL},
+		{ssh.IUTF8, unix.IUTF8},
+	}
+	localModes = []flagMode{
+		{ssh.ISIG, unix.ISIG},
+		{ssh.ICANON, unix.ICANON},
+		{ssh.ECHO, unix.ECHO},
+		{ssh.ECHOE, unix.ECHOE},
+		{ssh.ECHOK, unix.ECHOK},
+		{ssh.ECHONL, unix.ECHONL},
+		{ssh.NOFLSH, unix.NOFLSH},
+		{ssh.TOSTOP, unix.TOSTOP},
+		{ssh.IEXTEN, unix.IEXTEN},
+		{ssh.ECHOCTL, unix.ECHOCTL},
+		{ssh.ECHOKE, unix.ECHOKE},
+		{ssh.PENDIN, unix.PENDIN},
+	}
+	outputModes = []flagMode{
+		{ssh.OPOST, unix.OPOST},
+		{ssh.ONLCR, unix.ONLCR},
+		{ssh.OCRNL, unix.OCRNL},
+		{ssh.ONOCR, unix.ONOCR},
+		{ssh.ONLRET, unix.ONLRET},
+	}
+	// CS7 and CS8 are values of CSIZE rather than single bits, so only parity is a flag
+	parityModes = []flagMode{
+		{ssh.PARENB, unix.PARENB},
+		{ssh.PARODD, unix.PARODD},
+	}
+)
+
+// Modes returns the terminal modes of the terminal fd for a pty-req
+func Modes(fd int) (ssh.TerminalModes, error) {
+	termios, err := getTermios(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	modes := ssh.TerminalModes{}
+	for opcode, index := range controlChars {
+		modes[opcode] = uint32(termios.Cc[index])
+	}
+	getFlags(modes, uint64(termios.Iflag), inputModes)
+	getFlags(modes, uint64(termios.Lflag), localModes)
+	getFlags(modes, uint64(termios.Oflag), outputModes)
+	getFlags(modes, uint64(termios.Cflag), parityModes)
+	modes[ssh.CS7] = boolMode(uint64(termios.Cflag)&unix.CSIZE == unix.CS7)
+	modes[ssh.CS8] = boolMode(uint64(termios.Cflag)&unix.CSIZE == unix.CS8)
+	modes[ssh.TTY_OP_ISPEED], modes[ssh.TTY_OP_OSPEED] = speeds(termios)
+	return modes, nil
+}
+
+// ApplyModes sets the terminal modes of a pty-req on the terminal fd
+func ApplyModes(fd int, modes ssh.TerminalModes) error {
+	if len(modes) == 0 {
+		return nil
+	}
+	termios, err := getTermios(fd)
+	if err != nil {
+		return err
+	}
+
+	for opcode, index := range controlChars {
+		if value, ok := modes[opcode]; ok {
+			termios.Cc[index] = uint8(value)
+		}
+	}
+	termios.Iflag = tcflag(setFlags(uint64(termios.Iflag), modes, inputModes))
+	termios.Lflag = tcflag(setFlags(uint64(termios.Lflag), modes, localModes))
+	termios.Oflag = tcflag(setFlags(uint64(termios.Oflag), modes, outputModes))
+	cflag := uint64(termios.Cflag)
+	if modes[ssh.CS8] != 0 {
+		cflag = cflag&^unix.CSIZE | unix.CS8
+	} else if modes[ssh.CS7] != 0 {
+		cflag = cflag&^unix.CSIZE | unix.CS7
+	}
+	termios.Cflag = tcflag(setFlags(cflag, modes, parityModes))
+	return setTermios(fd, termios)
+}
+
+func getFlags(modes ssh.TerminalModes, flags uint64, table []flagMode) {
+	for _, mode := range table {
+		modes[mode.opcode] = boolMode(flags&mode.mask != 0)
+	}
+}
+
+func setFlags(flags uint64, modes ssh.TerminalModes, table []flagMode) uint64 {
+	for _, mode := range table {
+		value, ok := modes[mode.opcode]
+		if !ok {
+			continue
+		}
+		if value != 0 {
+			flags |= mode.mask
+		} else {
+			flags &^= mode.mask
+		}
+	}
+	return flags
+}
+
+func boolMode(set bool) uint32 {
+	if set {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,17 @@
+package terminal
+
+import "golang.org/x/sys/unix"
+
+type tcflag = uint64
+
+func getTermios(fd int) (*unix.Termios, error) {
+	return unix.IoctlGetTermios(fd, unix.TIOCGETA)
+}
+
+func setTermios(fd int, termios *unix.Termios) error {
+	return unix.IoctlSetTermios(fd, unix.TIOCSETA, termios)
+}
+
+func speeds(termios *unix.Termios) (uint32, uint32) {
+	return uint32(termios.Ispeed), uint32(termios.Ospeed)
+}
@@ -0,0 +1,36 @@
+package terminal
+
+import "golang.org/x/sys/unix"
+
+type tcflag = uint32
+
+// baudRates maps the CBAUD values of the c_cflag to bits per second
+var baudRates = map[uint32]uint32{
+	unix.B1200:   1200,
+	unix.B2400:   2400,
+	unix.B4800:   4800,
+	unix.B9600:   9600,
+	unix.B19200:  19200,
+	unix.B38400:  38400,
+	unix.B57600:  57600,
+	unix.B115200: 115200,
+	unix.B230400: 230400,
+	unix.B460800: 460800,
+	unix.B921600: 921600,
+}
+
+func getTermios(fd int) (*unix.Termios, error) {
+	return unix.IoctlGetTermios(fd, unix.TCGETS)
+}
+
+func setTermios(fd int, termios *unix.Termios) error {
+	return unix.IoctlSetTermios(fd, unix.TCSETS, termios)
+}
+
+func speeds(termios *unix.Termios) (uint32, uint32) {
+	speed, ok := baudRates[termios.Cflag&unix.CBAUD]
+	if !ok {
+		speed = 38400
+	}
+	return speed, speed
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+
+package terminal
+
+import "golang.org/x/crypto/ssh"
+
+// Modes returns no modes, the server then uses its defaults
+func Modes(fd int) (ssh.TerminalModes, error) {
+	return ssh.TerminalModes{}, nil
+}
+
+// ApplyModes is a no-op on this platform
+func ApplyModes(fd int, modes ssh.TerminalModes) error {
+	return nil
+}